@@ -0,0 +1,207 @@
+// Package asciicast reads and writes terminal recordings in the asciicast v2
+// format used by asciinema: a JSON header line followed by one JSON array
+// per event, [time, type, data], with the time in seconds since the start
+// of the recording.
+//
+// See https://docs.asciinema.org/manual/asciicast/v2/.
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Event types.
+const (
+	Output = "o" // data written to the terminal
+	Input  = "i" // data typed by the user
+	Resize = "r" // terminal resized, data is "COLSxROWS"
+	Marker = "m" // named point in the recording
+)
+
+// Header is the first line of a recording.
+type Header struct {
+	Version       int               `json:"version"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	Timestamp     int64             `json:"timestamp,omitempty"`
+	IdleTimeLimit float64           `json:"idle_time_limit,omitempty"`
+	Title         string            `json:"title,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+}
+
+// Event is one line of a recording after the header.
+type Event struct {
+	Time float64
+	Type string
+	Data string
+}
+
+// MarshalJSON encodes the event as the [time, type, data] array of the
+// format.
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{math.Round(e.Time*1e6) / 1e6, e.Type, e.Data})
+}
+
+// UnmarshalJSON decodes a [time, type, data] array.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("event has %d fields, want 3", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields[1], &e.Type); err != nil {
+		return err
+	}
+	return json.Unmarshal(fields[2], &e.Data)
+}
+
+// Writer records events with timestamps relative to its creation. Events
+// are buffered until Close. It is safe for concurrent use.
+type Writer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	buf   *bufio.Writer
+	start time.Time
+
+	// pending holds the start of a UTF-8 sequence split across two
+	// writes, since event data must be valid UTF-8.
+	pending []byte
+}
+
+// NewWriter writes the header of a recording to w. Version and Timestamp
+// are filled in when unset.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	now := time.Now()
+	h.Version = 2
+	if h.Timestamp == 0 {
+		h.Timestamp = now.Unix()
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(w)
+	if _, err := buf.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, buf: buf, start: now}, nil
+}
+
+// Output records data written to the terminal.
+func (w *Writer) Output(data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data = append(w.pending, data...)
+	end := len(data)
+	// Hold back an incomplete rune at the end, at most UTFMax-1 bytes.
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	w.pending = append([]byte(nil), data[end:]...)
+	if end == 0 {
+		return nil
+	}
+	return w.writeLocked(Output, string(data[:end]))
+}
+
+// Resize records a change of the terminal size.
+func (w *Writer) Resize(cols, rows int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writeLocked(Resize, fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (w *Writer) writeLocked(typ, data string) error {
+	line, err := json.Marshal(Event{Time: time.Since(w.start).Seconds(), Type: typ, Data: data})
+	if err != nil {
+		return err
+	}
+	_, err = w.buf.Write(append(line, '\n'))
+	return err
+}
+
+// Close records the end of a UTF-8 sequence still held back, writes out
+// the buffered events and closes the underlying writer if it is an
+// io.Closer.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	if len(w.pending) > 0 {
+		err = w.writeLocked(Output, string(w.pending))
+		w.pending = nil
+	}
+	if ferr := w.buf.Flush(); err == nil {
+		err = ferr
+	}
+	if c, ok := w.w.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Reader reads the events of a recording.
+type Reader struct {
+	Header Header
+	r      *bufio.Reader
+}
+
+// NewReader reads the header of a recording.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		if err == io.EOF {
+			return nil, errors.New("empty recording")
+		}
+		return nil, err
+	}
+	var h Header
+	if err := json.Unmarshal(line, &h); err != nil {
+		return nil, fmt.Errorf("malformed asciicast header: %v", err)
+	}
+	if h.Version != 2 {
+		return nil, fmt.Errorf("unsupported asciicast version %d, only version 2 is supported", h.Version)
+	}
+	return &Reader{Header: h, r: br}, nil
+}
+
+// Next returns the next event, or io.EOF at the end of the recording.
+func (r *Reader) Next() (Event, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\n') {
+			if err != nil {
+				return Event{}, err
+			}
+			continue
+		}
+		var e Event
+		if jerr := json.Unmarshal(line, &e); jerr != nil {
+			return Event{}, fmt.Errorf("malformed asciicast event: %v", jerr)
+		}
+		return e, nil
+	}
+}
@@ -0,0 +1,168 @@
+package asciicast
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{Width: 80, Height: 24, Title: "demo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "é" split across two writes must not be recorded as two invalid
+	// halves.
+	e := []byte("é")
+	_ = w.Output([]byte("caf"))
+	_ = w.Output(e[:1])
+	_ = w.Output(append(e[1:], "\r\n"...))
+	_ = w.Resize(120, 40)
+	// A sequence still incomplete when the recording ends is kept.
+	_ = w.Output(e[:1])
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes before Close; want the events buffered", buf.Len())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if r.Header.Version != 2 || r.Header.Width != 80 || r.Header.Height != 24 || r.Header.Title != "demo" || r.Header.Timestamp == 0 {
+		t.Errorf("header = %+v", r.Header)
+	}
+
+	var output strings.Builder
+	var resizes []string
+	for {
+		ev, err := r.Next()
+		if err != nil {
+			break
+		}
+		switch ev.Type {
+		case Output:
+			output.WriteString(ev.Data)
+		case Resize:
+			resizes = append(resizes, ev.Data)
+		}
+	}
+	if want := "café\r\n\ufffd"; output.String() != want {
+		t.Errorf("output = %q; want %q", output.String(), want)
+	}
+	if len(resizes) != 1 || resizes[0] != "120x40" {
+		t.Errorf("resizes = %q; want [120x40]", resizes)
+	}
+}
+
+func TestPlayIdleTimeLimit(t *testing.T) {
+	recording := `{"version": 2, "width": 80, "height": 24, "idle_time_limit": 0.01}
+[0.0, "o", "one "]
+[3600.0, "i", "typed"]
+[3600.5, "o", "two"]
+`
+	r, err := NewReader(strings.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	// Without the limit from the header this would take an hour.
+	if err := Play(r, &out, PlayOptions{Speed: 2}, nil); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	if out.String() != "one two" {
+		t.Errorf("played %q; want %q", out.String(), "one two")
+	}
+
+	// A limit given to Play replaces the one in the header.
+	r, _ = NewReader(strings.NewReader(strings.Replace(recording, "0.01", "3600", 1)))
+	out.Reset()
+	done := make(chan error, 1)
+	go func() { done <- Play(r, &out, PlayOptions{IdleTimeLimit: 0.01}, nil) }()
+	select {
+	case err := <-done:
+		if err != nil || out.String() != "one two" {
+			t.Errorf("Play = %v, played %q; want %q", err, out.String(), "one two")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Play ignored the idle time limit of its options")
+	}
+}
+
+// chanWriter passes every write on to a channel.
+type chanWriter chan string
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestPlayPauseAndStep(t *testing.T) {
+	recording := `{"version": 2, "width": 80, "height": 24}
+[0.0, "o", "a"]
+[3600.0, "o", "b"]
+[3600.01, "o", "c"]
+`
+	r, err := NewReader(strings.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(chanWriter)
+	keys := make(chan byte)
+	done := make(chan error, 1)
+	go func() { done <- Play(r, out, PlayOptions{}, keys) }()
+	next := func() string {
+		select {
+		case s := <-out:
+			return s
+		case <-time.After(5 * time.Second):
+			t.Fatal("nothing played")
+			return ""
+		}
+	}
+
+	if got := next(); got != "a" {
+		t.Fatalf("played %q first; want a", got)
+	}
+	// While paused, '.' plays the next event without waiting for it and
+	// events that are due wait for the replay to resume.
+	keys <- ' '
+	keys <- '.'
+	if got := next(); got != "b" {
+		t.Fatalf("stepped to %q; want b", got)
+	}
+	select {
+	case s := <-out:
+		t.Fatalf("played %q while paused", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+	keys <- ' '
+	if got := next(); got != "c" {
+		t.Fatalf("resumed with %q; want c", got)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+}
+
+func TestPlayQuit(t *testing.T) {
+	recording := "{\"version\": 2, \"width\": 80, \"height\": 24}\n[0.0, \"o\", \"one\"]\n[3600.0, \"o\", \"two\"]\n"
+	r, err := NewReader(strings.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(chan byte, 1)
+	keys <- 'q'
+	var out bytes.Buffer
+	if err := Play(r, &out, PlayOptions{}, keys); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	// The first event is due immediately, the second one never comes.
+	if out.String() != "one" && out.Len() != 0 {
+		t.Errorf("played %q; want at most %q", out.String(), "one")
+	}
+}
@@ -0,0 +1,85 @@
+package asciicast
+
+import (
+	"io"
+	"time"
+)
+
+// PlayOptions control the replay of a recording.
+type PlayOptions struct {
+	// Speed multiplies the playback speed; values <= 0 mean 1.
+	Speed float64
+
+	// IdleTimeLimit caps pauses between events, in seconds. Zero uses the
+	// limit stored in the recording, if any.
+	IdleTimeLimit float64
+}
+
+// Play writes the output events of a recording to out with their original
+// timing. Keys read from keys control the replay: space pauses and resumes,
+// '.' shows the next event while paused, and q or Ctrl-C stops. Input,
+// resize and marker events are skipped.
+func Play(r *Reader, out io.Writer, opts PlayOptions, keys <-chan byte) error {
+	speed := opts.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	idle := opts.IdleTimeLimit
+	if idle == 0 {
+		idle = r.Header.IdleTimeLimit
+	}
+
+	paused := false
+	last := 0.0
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if e.Type != Output {
+			continue
+		}
+
+		delay := max(e.Time-last, 0)
+		last = e.Time
+		if idle > 0 {
+			delay = min(delay, idle)
+		}
+		timer := time.NewTimer(time.Duration(delay / speed * float64(time.Second)))
+	wait:
+		for {
+			var timeout <-chan time.Time
+			if !paused {
+				timeout = timer.C
+			}
+			select {
+			case <-timeout:
+				break wait
+			case key, ok := <-keys:
+				if !ok {
+					keys = nil
+					continue
+				}
+				switch key {
+				case 'q', 0x03:
+					timer.Stop()
+					return nil
+				case ' ':
+					paused = !paused
+				case '.':
+					if paused {
+						break wait
+					}
+				}
+			}
+		}
+		timer.Stop()
+
+		if _, err := io.WriteString(out, e.Data); err != nil {
+			return err
+		}
+	}
+}
@@ -21,9 +21,11 @@ type TerminalMultiplexer interface {
 	GetSessions() ([]string, error)
 	DumpSession(name string) (string, error)
 	AttachSession(name string) error
-	DetachSession() error
+	DetachSession(session, client string) error
 	KillSession(name string) error
 	RenameSession(oldName, newName string) error
+	RespawnSession(name string) error
+	WaitSession(session string, opts WaitOptions) error
 	NukeAllSessions() error
 
 	// Window Management
@@ -39,6 +41,8 @@ type TerminalMultiplexer interface {
 	ListPanes(session, window string) error
 	KillPane(session, window, pane string) error
 	Exec(session, window, pane, command string) error
+	SendKeys(session, window, pane string, keys []Key) error
+	CapturePane(session, window, pane string) (string, error)
 }
 
 // preserveEnvironment ensures proper environment variables are passed to subprocess
@@ -79,11 +83,17 @@ type Manager struct {
 
 // NewManager creates a new backend manager
 func NewManager(cfg *config.Config, log *logger.Logger) *Manager {
+	native := NewNativeBackend()
+	if prefix, err := config.ParsePrefixKey(cfg.PrefixKey); err == nil {
+		native.prefix, native.prefixName = prefix, cfg.PrefixKey
+	}
+	native.emacsKeys = cfg.ModeKeys == "emacs"
+
 	backends := map[config.BackendType]TerminalMultiplexer{
 		config.BackendTmux:   NewTmuxBackend(),
 		config.BackendZellij: NewZellijBackend(),
 		config.BackendScreen: NewScreenBackend(),
-		config.BackendNative: NewNativeBackend(),
+		config.BackendNative: native,
 	}
 
 	var selectedBackend TerminalMultiplexer
@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExecWait runs a command in the shell of a pane like Exec, waits for it to
+// finish and returns its output and exit status. The command is wrapped in
+// markers that delimit its output on the screen; the shell must understand
+// printf, eval and $?, as POSIX shells do.
+func ExecWait(m TerminalMultiplexer, session, window, pane, command string, timeout time.Duration) (string, int, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", 0, err
+	}
+	marker := "txm-" + hex.EncodeToString(id)
+	// printf assembles the markers so that the command line, which the
+	// terminal echoes too, never contains them. The end marker starts a
+	// line of its own, so that it cannot wrap after long output without a
+	// trailing newline.
+	wrapped := fmt.Sprintf("printf '%%s-start\\n' %s; eval %s; printf '\\n%%s-end %%d\\n' %s $?",
+		marker, shellQuote(command), marker)
+	end := regexp.MustCompile(regexp.QuoteMeta(marker) + `-end (\d+)`)
+
+	if err := m.Exec(session, window, pane, wrapped); err != nil {
+		return "", 0, err
+	}
+	opts := WaitOptions{Window: window, Pane: pane, Match: end, Timeout: timeout}
+	if err := m.WaitSession(session, opts); err != nil {
+		return "", 0, err
+	}
+	text, err := m.CapturePane(session, window, pane)
+	if err != nil {
+		return "", 0, err
+	}
+	return parseExecOutput(text, marker, end)
+}
+
+// parseExecOutput extracts the output between the last start marker and
+// the end marker after it, less the newline printed before the end
+// marker. When the start marker has already left the scrollback, the
+// output starts at the oldest line.
+func parseExecOutput(text, marker string, end *regexp.Regexp) (string, int, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == marker+"-start" {
+			start = i
+		}
+	}
+	for i := start + 1; i < len(lines); i++ {
+		loc := end.FindStringSubmatchIndex(lines[i])
+		if loc == nil {
+			continue
+		}
+		status, err := strconv.Atoi(lines[i][loc[2]:loc[3]])
+		if err != nil {
+			return "", 0, err
+		}
+		output := lines[start+1 : i]
+		for j, line := range output {
+			output[j] = strings.TrimRight(line, " ")
+		}
+		return strings.Join(output, "\n"), status, nil
+	}
+	return "", 0, fmt.Errorf("the end of the command's output was not found")
+}
+
+// shellQuote quotes s as a single word for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,57 @@
+package backend
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestParseExecOutput(t *testing.T) {
+	end := regexp.MustCompile(`txm-ab-end (\d+)`)
+	tests := []struct {
+		name   string
+		text   string
+		output string
+		status int
+	}{
+		{
+			"Output between markers",
+			"$ printf '%s-start\\n' txm-ab; eval 'ls'; printf '\\n%s-end %d\\n' txm-ab $?\r\ntxm-ab-start\r\na.txt   \r\nb.txt\r\n\r\ntxm-ab-end 0\r\n$ ",
+			"a.txt\nb.txt\n", 0,
+		},
+		{
+			"Output without trailing newline",
+			"txm-ab-start\nno newline\ntxm-ab-end 3\n$",
+			"no newline", 3,
+		},
+		{
+			"Last run wins",
+			"txm-ab-start\nold\n\ntxm-ab-start\nnew\n\ntxm-ab-end 1\n",
+			"new\n", 1,
+		},
+		{
+			"Start scrolled away",
+			"tail\n\ntxm-ab-end 0\n",
+			"tail\n", 0,
+		},
+		{
+			"No output",
+			"txm-ab-start\n\ntxm-ab-end 0\n",
+			"", 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, status, err := parseExecOutput(tt.text, "txm-ab", end)
+			if err != nil || output != tt.output || status != tt.status {
+				t.Errorf("parseExecOutput = %q, %d, %v; want %q, %d", output, status, err, tt.output, tt.status)
+			}
+		})
+	}
+
+	if _, _, err := parseExecOutput("txm-ab-start\nstill running\n", "txm-ab", end); err == nil {
+		t.Error("parsed output without an end marker")
+	}
+	if got, want := shellQuote("it's"), `'it'\''s'`; got != want {
+		t.Errorf("shellQuote = %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package backend
+
+import (
+	"strings"
+)
+
+// Key is one element of the input sent by send-keys: a named key such as
+// C-c or Up, or literal text.
+type Key struct {
+	// Name is the tmux name of a named key and empty for literal text.
+	Name string
+	// Data is what a terminal sends for the key, or the literal text.
+	Data []byte
+}
+
+// namedKeys maps the key names send-keys understands, in lower case, to the
+// tmux name and the VT encoding of the key. The aliases are the names other
+// tools use for the same keys.
+var namedKeys = map[string]Key{
+	"enter":    {"Enter", []byte("\r")},
+	"escape":   {"Escape", []byte("\x1b")},
+	"esc":      {"Escape", []byte("\x1b")},
+	"tab":      {"Tab", []byte("\t")},
+	"btab":     {"BTab", []byte("\x1b[Z")},
+	"space":    {"Space", []byte(" ")},
+	"bspace":   {"BSpace", []byte("\x7f")},
+	"up":       {"Up", []byte("\x1b[A")},
+	"down":     {"Down", []byte("\x1b[B")},
+	"right":    {"Right", []byte("\x1b[C")},
+	"left":     {"Left", []byte("\x1b[D")},
+	"home":     {"Home", []byte("\x1b[H")},
+	"end":      {"End", []byte("\x1b[F")},
+	"ppage":    {"PPage", []byte("\x1b[5~")},
+	"pageup":   {"PPage", []byte("\x1b[5~")},
+	"npage":    {"NPage", []byte("\x1b[6~")},
+	"pagedown": {"NPage", []byte("\x1b[6~")},
+	"ic":       {"IC", []byte("\x1b[2~")},
+	"insert":   {"IC", []byte("\x1b[2~")},
+	"dc":       {"DC", []byte("\x1b[3~")},
+	"delete":   {"DC", []byte("\x1b[3~")},
+	"f1":       {"F1", []byte("\x1bOP")},
+	"f2":       {"F2", []byte("\x1bOQ")},
+	"f3":       {"F3", []byte("\x1bOR")},
+	"f4":       {"F4", []byte("\x1bOS")},
+	"f5":       {"F5", []byte("\x1b[15~")},
+	"f6":       {"F6", []byte("\x1b[17~")},
+	"f7":       {"F7", []byte("\x1b[18~")},
+	"f8":       {"F8", []byte("\x1b[19~")},
+	"f9":       {"F9", []byte("\x1b[20~")},
+	"f10":      {"F10", []byte("\x1b[21~")},
+	"f11":      {"F11", []byte("\x1b[23~")},
+	"f12":      {"F12", []byte("\x1b[24~")},
+}
+
+// ParseKeys turns send-keys arguments into keys using the tmux grammar:
+// an argument naming a key (Enter, Up, F5, ...), optionally prefixed with
+// C- for Ctrl and M- for Meta, is that key, and anything else is literal
+// text. Names are case-insensitive. With literal set every argument is
+// text.
+func ParseKeys(args []string, literal bool) []Key {
+	keys := make([]Key, 0, len(args))
+	for _, arg := range args {
+		if !literal {
+			if key, ok := lookupKey(arg); ok {
+				keys = append(keys, key)
+				continue
+			}
+		}
+		keys = append(keys, Key{Data: []byte(arg)})
+	}
+	return keys
+}
+
+// lookupKey resolves a key name with its modifiers.
+func lookupKey(name string) (Key, bool) {
+	var ctrl, meta bool
+	rest := name
+	for len(rest) > 2 && rest[1] == '-' {
+		switch rest[0] {
+		case 'C', 'c':
+			ctrl = true
+		case 'M', 'm':
+			meta = true
+		default:
+			return Key{}, false
+		}
+		rest = rest[2:]
+	}
+
+	var key Key
+	if named, ok := namedKeys[strings.ToLower(rest)]; ok {
+		key = Key{Name: named.Name, Data: named.Data}
+		if ctrl {
+			key.Name = "C-" + key.Name
+			key.Data = ctrlNamedKey(named)
+		}
+	} else if len(rest) == 1 && (ctrl || meta) {
+		c := rest[0]
+		key = Key{Name: rest, Data: []byte{c}}
+		if ctrl {
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			if c != '?' && c != ' ' && (c < '@' || c > '_') && (c < 'a' || c > 'z') {
+				return Key{}, false
+			}
+			key = Key{Name: "C-" + string(c), Data: []byte{ctrlByte(c)}}
+		}
+	} else {
+		return Key{}, false
+	}
+
+	if meta {
+		key.Name = "M-" + key.Name
+		key.Data = append([]byte{0x1b}, key.Data...)
+	}
+	return key, true
+}
+
+// ctrlNamedKey returns what xterm sends for a named key with Ctrl: the
+// escape sequence with a modifier parameter, or a control character.
+func ctrlNamedKey(key Key) []byte {
+	data := key.Data
+	switch {
+	case key.Name == "Space":
+		return []byte{0}
+	case key.Name == "BSpace":
+		return []byte{0x08}
+	case len(data) == 1:
+		return data
+	case data[len(data)-1] == '~':
+		return []byte(string(data[:len(data)-1]) + ";5~")
+	default:
+		// CSI or SS3 followed by a single final byte.
+		return []byte("\x1b[1;5" + string(data[len(data)-1]))
+	}
+}
+
+// ctrlByte returns the control character a terminal sends for Ctrl and c.
+func ctrlByte(c byte) byte {
+	switch c {
+	case '?':
+		return 0x7f
+	case ' ':
+		return 0
+	}
+	return c & 0x1f
+}
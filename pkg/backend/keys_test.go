@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		arg  string
+		name string
+		data string
+	}{
+		{"Enter", "Enter", "\r"},
+		{"escape", "Escape", "\x1b"},
+		{"C-c", "C-c", "\x03"},
+		{"C-C", "C-c", "\x03"},
+		{"C-Space", "C-Space", "\x00"},
+		{"M-x", "M-x", "\x1bx"},
+		{"C-M-a", "M-C-a", "\x1b\x01"},
+		{"Up", "Up", "\x1b[A"},
+		{"C-Left", "C-Left", "\x1b[1;5D"},
+		{"PageUp", "PPage", "\x1b[5~"},
+		{"C-DC", "C-DC", "\x1b[3;5~"},
+		{"F1", "F1", "\x1bOP"},
+		{"M-F5", "M-F5", "\x1b\x1b[15~"},
+		{"ls -la", "", "ls -la"},
+		{"C-", "", "C-"},
+		{"C-Hello", "", "C-Hello"},
+		{"X-c", "", "X-c"},
+	}
+	for _, tt := range tests {
+		keys := ParseKeys([]string{tt.arg}, false)
+		if keys[0].Name != tt.name || string(keys[0].Data) != tt.data {
+			t.Errorf("ParseKeys(%q) = %q %q; want %q %q", tt.arg, keys[0].Name, keys[0].Data, tt.name, tt.data)
+		}
+	}
+
+	if keys := ParseKeys([]string{"Enter"}, true); keys[0].Name != "" || string(keys[0].Data) != "Enter" {
+		t.Errorf("literal ParseKeys(Enter) = %+v; want the text", keys[0])
+	}
+}
+
+func TestSendKeysEncoding(t *testing.T) {
+	keys := ParseKeys([]string{"echo a;", "Enter", "C-c"}, false)
+
+	got := strings.Join(tmuxSendKeysArgs("s:w.1", keys), " ")
+	want := `send-keys -t s:w.1 -l -- echo a\; ; send-keys -t s:w.1 Enter ; send-keys -t s:w.1 C-c`
+	if got != want {
+		t.Errorf("tmux args = %s\nwant %s", got, want)
+	}
+
+	if got, want := screenEscape([]byte("$HOME ^x \\ 'q'\r\x03")), `\$HOME \^x \\ \'q\'\015\003`; got != want {
+		t.Errorf("screenEscape = %s; want %s", got, want)
+	}
+}
@@ -1,22 +1,39 @@
 package backend
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"golang.org/x/term"
+
+	"github.com/MohamedElashri/txm/pkg/config"
 )
 
-type NativeBackend struct{}
+type NativeBackend struct {
+	// prefix starts a command in the attach client, see attachClient.
+	prefix     byte
+	prefixName string
+
+	// emacsKeys selects the emacs bindings in copy mode instead of vi.
+	emacsKeys bool
+}
 
 func NewNativeBackend() *NativeBackend {
-	return &NativeBackend{}
+	prefix, _ := config.ParsePrefixKey(config.DefaultPrefixKey)
+	return &NativeBackend{
+		prefix:     prefix,
+		prefixName: config.DefaultPrefixKey,
+	}
 }
 
 func (b *NativeBackend) Name() string {
@@ -27,19 +44,108 @@ func (b *NativeBackend) IsAvailable() bool {
 	return true
 }
 
-func getSocketPath(name string) string {
-	return filepath.Join(os.TempDir(), fmt.Sprintf("txm-%s.sock", name))
+// dialSession connects to a native session server and performs the protocol
+// handshake.
+func dialSession(name string) (*FrameConn, error) {
+	return dialSessionHello(name, Hello{})
+}
+
+// dialSessionHello is dialSession with options for the handshake.
+func dialSessionHello(name string, hello Hello) (*FrameConn, error) {
+	conn, err := dialSocket(name)
+	if err != nil {
+		return nil, err
+	}
+	fc := NewFrameConn(conn)
+	if _, err := fc.ClientHello(hello); err != nil {
+		_ = fc.Close()
+		return nil, err
+	}
+	return fc, nil
+}
+
+// dialSocket connects to a session's socket without speaking the protocol.
+// For another user's shared session it also verifies that the server runs
+// as that user.
+func dialSocket(name string) (net.Conn, error) {
+	path, err := findSocket(name)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(name, "/") {
+		_, owner, err := sharedSocket(name)
+		if err == nil {
+			var cred Cred
+			if cred, err = PeerCred(conn); err == nil && cred.UID != owner {
+				err = fmt.Errorf("session %s is served by uid %d instead of its owner; refusing to connect", name, cred.UID)
+			}
+		}
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// sessionCommand sends a control command to a native session server and
+// decodes its return value into out, when out is non-nil.
+func sessionCommand(session string, out interface{}, name string, args ...string) error {
+	fc, err := dialSession(session)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fc.Close() }()
+	return sendCommand(fc, out, name, args...)
+}
+
+// sendCommand runs a control command over an established connection.
+func sendCommand(fc *FrameConn, out interface{}, name string, args ...string) error {
+	data, err := json.Marshal(Command{Name: name, Args: args})
+	if err != nil {
+		return err
+	}
+	if err := fc.WriteFrame(MsgCommand, data); err != nil {
+		return err
+	}
+
+	typ, payload, err := fc.ReadFrame()
+	if err != nil {
+		return err
+	}
+	if typ == MsgError {
+		return fmt.Errorf("%s", payload)
+	}
+	var result CommandResult
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return fmt.Errorf("malformed reply from session server: %v", err)
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+	if out != nil && len(result.Data) > 0 {
+		return json.Unmarshal(result.Data, out)
+	}
+	return nil
 }
 
 func (b *NativeBackend) SessionExists(name string) bool {
-	_, err := os.Stat(getSocketPath(name))
-	return err == nil
+	path, err := findSocket(name)
+	return err == nil && !socketStale(path)
 }
 
 func (b *NativeBackend) CreateSession(name string, command ...string) error {
 	if b.SessionExists(name) {
 		return fmt.Errorf("session %s already exists", name)
 	}
+	// Validate the socket directory here, where the error can be shown.
+	if _, err := SocketDir(); err != nil {
+		return err
+	}
 
 	exe, err := os.Executable()
 	if err != nil {
@@ -73,25 +179,86 @@ func (b *NativeBackend) CreateSession(name string, command ...string) error {
 }
 
 func (b *NativeBackend) ListSessions() error {
-	sessions, err := b.GetSessions()
+	sockets, err := listSockets()
 	if err != nil {
 		return err
 	}
-	for _, s := range sessions {
-		conn, err := net.Dial("unix", getSocketPath(s))
-		if err == nil {
-			_, _ = conn.Write([]byte{0x04}) // Status query
-			buf := make([]byte, 1)
-			_, err = conn.Read(buf)
-			_ = conn.Close()
-			if err == nil {
-				fmt.Printf("%s [Attached: %d]\n", s, buf[0])
-				continue
-			}
+	if len(sockets) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tCLIENTS\tSIZE\tPID\tRUNNING\tCREATED\tLAST ATTACH\tCOMMAND\tLOG")
+	for _, sock := range sockets {
+		s := sock.name
+		if sock.stale {
+			fmt.Fprintf(w, "%s\tstale (server is gone, run txm gc)\n", s)
+			continue
+		}
+		st, err := sessionStatus(s)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t[%v]\n", s, err)
+			continue
+		}
+		clients := fmt.Sprint(st.Clients)
+		if st.ReadOnly > 0 {
+			clients += fmt.Sprintf(" (%d read-only)", st.ReadOnly)
+		}
+		status := "running"
+		if st.Dead {
+			status = "dead (" + st.ExitStatus + ")"
+		}
+		if st.Recording != "" {
+			status += ", recording"
+		}
+		if sock.legacy {
+			status += ", legacy socket"
 		}
-		fmt.Println(s)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%dx%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			s, status, clients, st.Cols, st.Rows, st.PID, orDash(st.Foreground),
+			formatTime(st.Created), formatTime(st.LastAttach),
+			orDash(strings.Join(st.Command, " ")), orDash(st.LogFile))
 	}
-	return nil
+	return w.Flush()
+}
+
+// sessionStatus queries the status of a native session.
+func sessionStatus(name string) (SessionStatus, error) {
+	fc, err := dialSession(name)
+	if err != nil {
+		return SessionStatus{}, err
+	}
+	defer func() { _ = fc.Close() }()
+
+	if err := fc.WriteFrame(MsgStatus, nil); err != nil {
+		return SessionStatus{}, err
+	}
+	typ, payload, err := fc.ReadFrame()
+	if err != nil {
+		return SessionStatus{}, err
+	}
+	if typ == MsgError {
+		return SessionStatus{}, fmt.Errorf("%s", payload)
+	}
+	var st SessionStatus
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return SessionStatus{}, fmt.Errorf("malformed status from session server: %v", err)
+	}
+	return st, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
 }
 
 func (b *NativeBackend) DumpSession(name string) (string, error) {
@@ -99,46 +266,52 @@ func (b *NativeBackend) DumpSession(name string) (string, error) {
 		return "", fmt.Errorf("session %s does not exist", name)
 	}
 
-	conn, err := net.Dial("unix", getSocketPath(name))
+	fc, err := dialSession(name)
 	if err != nil {
 		return "", err
 	}
-	defer func() { _ = conn.Close() }()
+	defer func() { _ = fc.Close() }()
 
-	_, _ = io.WriteString(conn, "\x05")
-	buf, _ := io.ReadAll(conn)
-	return string(buf), nil
+	if err := fc.WriteFrame(MsgDump, nil); err != nil {
+		return "", err
+	}
+	typ, payload, err := fc.ReadFrame()
+	if err != nil {
+		return "", err
+	}
+	if typ == MsgError {
+		return "", fmt.Errorf("%s", payload)
+	}
+	return string(payload), nil
 }
 
+// GetSessions returns the sessions with a live server; sockets left behind
+// by servers that died are skipped.
 func (b *NativeBackend) GetSessions() ([]string, error) {
-	files, err := filepath.Glob(filepath.Join(os.TempDir(), "txm-*.sock"))
+	sockets, err := listSockets()
 	if err != nil {
 		return nil, err
 	}
-
 	var sessions []string
-	for _, f := range files {
-		base := filepath.Base(f)
-		name := strings.TrimPrefix(base, "txm-")
-		name = strings.TrimSuffix(name, ".sock")
-		sessions = append(sessions, name)
+	for _, s := range sockets {
+		if !s.stale {
+			sessions = append(sessions, s.name)
+		}
 	}
 	return sessions, nil
 }
 
+// AttachSession attaches the terminal to a session. With TXM_ATTACH_VIA
+// set, the session is reached through that command instead of the local
+// socket, see dialVia, and with TXM_ATTACH_RECONNECT set a lost connection
+// is dialed again. TXM_ATTACH_DETACH_OTHERS detaches the other clients and
+// TXM_ATTACH_SYNC asks for synchronized rendering.
 func (b *NativeBackend) AttachSession(name string) error {
-	if !b.SessionExists(name) {
+	via := os.Getenv("TXM_ATTACH_VIA")
+	if via == "" && !b.SessionExists(name) {
 		return fmt.Errorf("session %s does not exist", name)
 	}
 
-	conn, err := net.Dial("unix", getSocketPath(name))
-	if err != nil {
-		return fmt.Errorf("failed to connect to session: %v", err)
-	}
-	defer func() { _ = conn.Close() }()
-
-	_, _ = conn.Write([]byte{0x00}) // Identify as attach
-
 	// Put terminal in raw mode
 	fd := int(os.Stdin.Fd())
 	oldState, err := term.MakeRaw(fd)
@@ -147,122 +320,285 @@ func (b *NativeBackend) AttachSession(name string) error {
 	}
 	defer func() { _ = term.Restore(fd, oldState) }()
 
-	// Handle window resize
-	watchWindowSize(fd, conn)
+	// Being killed or losing the terminal must not leave it in raw mode.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(signals)
 
-	errChan := make(chan error, 1)
-
-	// Copy from conn to stdout
+	// A single reader outlives the connections so that switching sessions
+	// cannot lose keystrokes to a stale reader.
+	input := make(chan stdinChunk)
 	go func() {
-		_, err := io.Copy(os.Stdout, conn)
-		errChan <- err
-	}()
-
-	readOnly := os.Getenv("TXM_READ_ONLY") == "1"
-
-	// Copy from stdin to conn (wrapped in data packets)
-	if !readOnly {
-		go func() {
-			buf := make([]byte, 1024)
-			for {
+		buf := make([]byte, 4096)
+		for {
 			n, err := os.Stdin.Read(buf)
+			input <- stdinChunk{data: append([]byte(nil), buf[:n]...), err: err}
 			if err != nil {
-				errChan <- err
 				return
 			}
+		}
+	}()
 
-			// Scan for Ctrl+\ (0x1C)
-			detachIdx := -1
-			for i := 0; i < n; i++ {
-				if buf[i] == 0x1C {
-					detachIdx = i
-					break
-				}
-			}
+	a := &attachClient{
+		b:         b,
+		fd:        fd,
+		input:     input,
+		readOnly:  os.Getenv("TXM_READ_ONLY") == "1",
+		reconnect: os.Getenv("TXM_ATTACH_RECONNECT") == "1",
+		signals:   signals,
+		dial:      dialSessionHello,
+
+		detachOthers: os.Getenv("TXM_ATTACH_DETACH_OTHERS") == "1",
+		tty:          ttyName(os.Stdin),
+		sync:         os.Getenv("TXM_ATTACH_SYNC") == "1",
+	}
+	if via != "" {
+		a.remote = true
+		a.dial = func(name string, hello Hello) (*FrameConn, error) {
+			return dialVia(via, name, hello)
+		}
+	}
 
-			if detachIdx != -1 {
-				if detachIdx > 0 {
-					payload := append([]byte{0x01}, buf[:detachIdx]...)
-					if _, err := conn.Write(payload); err != nil {
-						errChan <- err
-						return
-					}
-				}
-				errChan <- nil // Gracefully detach
-				return
-			}
-			
-			payload := append([]byte{0x01}, buf[:n]...)
-			if _, err := conn.Write(payload); err != nil {
-				errChan <- err
-				return
-			}
+	err = a.run(name)
+	_ = term.Restore(fd, oldState)
+	switch {
+	case errors.Is(err, errSessionEnded):
+		fmt.Printf("[txm: session %s ended]\n", a.name)
+		return nil
+	case errors.Is(err, errConnectionLost):
+		fmt.Printf("[txm: lost the connection to session %s]\n", a.name)
+		return nil
+	case errors.Is(err, errKicked):
+		fmt.Printf("[txm: detached from session %s by another client]\n", a.name)
+		return nil
+	}
+	return err
+}
+
+// DetachSession detaches clients from a native session. Without a session it
+// detaches the client typing into the session this process runs in; with a
+// session but no client it detaches every client of that session.
+func (b *NativeBackend) DetachSession(session, client string) error {
+	if session == "" {
+		current, err := currentSession()
+		if err != nil {
+			return err
 		}
-	}()
+		return sessionCommand(current, nil, "detach-client", client)
+	}
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
 	}
+	if client == "" {
+		client = "all"
+	}
+	return sessionCommand(session, nil, "detach-client", client)
+}
 
-	<-errChan
-	return nil
+// SessionClients lists the clients attached to a native session in the
+// order they attached.
+func SessionClients(session string) ([]ClientInfo, error) {
+	var clients []ClientInfo
+	err := sessionCommand(session, &clients, "list-clients")
+	return clients, err
 }
 
-func (b *NativeBackend) DetachSession() error {
-	return fmt.Errorf("to detach from a native session, close the terminal window or use a detach sequence (WIP)")
+// KickClient disconnects one client of a native session, which is told
+// that another client detached it.
+func KickClient(session, client string) error {
+	return sessionCommand(session, nil, "kick-client", client)
+}
+
+// currentSession finds the native session the calling process runs in from
+// the identity the server exports to its children. The session may have
+// been renamed since the process started, so TXM_SESSION_ID is
+// authoritative and TXM_SESSION only a hint.
+func currentSession() (string, error) {
+	id := os.Getenv("TXM_SESSION_ID")
+	if id == "" {
+		return "", fmt.Errorf("not running inside a native session; specify a session to detach from")
+	}
+
+	matches := func(name string) bool {
+		var sessionID string
+		return sessionCommand(name, &sessionID, "session-id") == nil && sessionID == id
+	}
+	if name := os.Getenv("TXM_SESSION"); name != "" && matches(name) {
+		return name, nil
+	}
+	sessions, err := NewNativeBackend().GetSessions()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range sessions {
+		if matches(name) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("the session this shell runs in no longer exists")
 }
 
 func (b *NativeBackend) KillSession(name string) error {
-	if !b.SessionExists(name) {
-		return fmt.Errorf("session %s does not exist", name)
+	if _, err := findSocket(name); err != nil {
+		return err
 	}
-	
-	conn, err := net.Dial("unix", getSocketPath(name))
+
+	fc, err := dialSession(name)
 	if err != nil {
-		_ = os.Remove(getSocketPath(name))
-		return nil
+		// Nobody is listening: clean up the leftover socket. Handshake
+		// failures mean a live server we cannot talk to, so report them.
+		var opErr *net.OpError
+		if errors.As(err, &opErr) {
+			if path, err := findSocket(name); err == nil {
+				_ = os.Remove(path)
+			}
+			return nil
+		}
+		return err
 	}
-	defer func() { _ = conn.Close() }()
-	
-	_, _ = conn.Write([]byte{0x03})
-	return nil
+	defer func() { _ = fc.Close() }()
+
+	return fc.WriteFrame(MsgKill, nil)
 }
 
 func (b *NativeBackend) RenameSession(oldName, newName string) error {
-	return fmt.Errorf("renaming sessions is not supported by the native backend")
+	if !b.SessionExists(oldName) {
+		return fmt.Errorf("session %s does not exist", oldName)
+	}
+	if b.SessionExists(newName) {
+		return fmt.Errorf("session %s already exists", newName)
+	}
+	return sessionCommand(oldName, nil, "rename-session", newName)
+}
+
+// RespawnSession restarts the original command of every dead pane of a
+// session created with remain-on-exit.
+func (b *NativeBackend) RespawnSession(name string) error {
+	if !b.SessionExists(name) {
+		return fmt.Errorf("session %s does not exist", name)
+	}
+	return sessionCommand(name, nil, "respawn")
+}
+
+// RecordSession starts an asciicast v2 recording of what the clients of a
+// native session see. path should be absolute since the server resolves it.
+func RecordSession(session, path string) error {
+	return sessionCommand(session, nil, "record-start", path)
+}
+
+// StopRecording finishes the recording of a native session.
+func StopRecording(session string) error {
+	return sessionCommand(session, nil, "record-stop")
+}
+
+// SessionSizePolicy sets the size policy of a native session, unless
+// policy is empty, and returns the policy in effect.
+func SessionSizePolicy(session, policy string) (string, error) {
+	var current string
+	err := sessionCommand(session, &current, "size-policy", policy)
+	return current, err
+}
+
+// SessionBuffers returns the paste buffers of a native session, most recent
+// first. Copy mode adds a buffer for every copied selection.
+func SessionBuffers(session string) ([]string, error) {
+	var buffers []string
+	err := sessionCommand(session, &buffers, "list-buffers")
+	return buffers, err
+}
+
+// PasteBuffer types a paste buffer of a native session into its active
+// pane. Index 0 is the most recent buffer.
+func PasteBuffer(session string, index int) error {
+	return sessionCommand(session, nil, "paste-buffer", strconv.Itoa(index))
 }
 
 func (b *NativeBackend) NewWindow(session, name string) error {
-	return fmt.Errorf("window management is not supported by the native backend")
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	return sessionCommand(session, nil, "new-window", name)
 }
 
 func (b *NativeBackend) ListWindows(session string) error {
-	return fmt.Errorf("window management is not supported by the native backend")
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	var windows []WindowInfo
+	if err := sessionCommand(session, &windows, "list-windows"); err != nil {
+		return err
+	}
+	for _, w := range windows {
+		marker := ""
+		if w.Active {
+			marker = "*"
+		}
+		fmt.Printf("%d: %s%s (%d panes) [%dx%d]\n", w.ID, w.Name, marker, w.Panes, w.Cols, w.Rows)
+	}
+	return nil
 }
 
 func (b *NativeBackend) KillWindow(session, window string) error {
-	return fmt.Errorf("window management is not supported by the native backend")
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	return sessionCommand(session, nil, "kill-window", window)
 }
 
 func (b *NativeBackend) NextWindow(session string) error {
-	return fmt.Errorf("window management is not supported by the native backend")
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	return sessionCommand(session, nil, "select-window", "next")
 }
 
 func (b *NativeBackend) PreviousWindow(session string) error {
-	return fmt.Errorf("window management is not supported by the native backend")
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	return sessionCommand(session, nil, "select-window", "prev")
 }
 
 func (b *NativeBackend) RenameWindow(session, oldName, newName string) error {
-	return fmt.Errorf("window management is not supported by the native backend")
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	return sessionCommand(session, nil, "rename-window", oldName, newName)
 }
 
 func (b *NativeBackend) SplitWindow(session, window, direction string) error {
-	return fmt.Errorf("window management is not supported by the native backend")
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	return sessionCommand(session, nil, "split-window", window, direction)
 }
 
 func (b *NativeBackend) ListPanes(session, window string) error {
-	return fmt.Errorf("pane management is not supported by the native backend")
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	var panes []PaneInfo
+	if err := sessionCommand(session, &panes, "list-panes", window); err != nil {
+		return err
+	}
+	for _, p := range panes {
+		marker := ""
+		if p.Dead {
+			marker = " (dead)"
+		}
+		if p.Active {
+			marker += " (active)"
+		}
+		fmt.Printf("%d: %s [%dx%d] pid %d%s\n", p.ID, p.Command, p.Cols, p.Rows, p.PID, marker)
+	}
+	return nil
 }
 
 func (b *NativeBackend) KillPane(session, window, pane string) error {
-	return fmt.Errorf("pane management is not supported by the native backend")
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	return sessionCommand(session, nil, "kill-pane", window, pane)
 }
 
 func (b *NativeBackend) Exec(session, window, pane, command string) error {
@@ -270,15 +606,118 @@ func (b *NativeBackend) Exec(session, window, pane, command string) error {
 		return fmt.Errorf("session %s does not exist", session)
 	}
 
-	conn, err := net.Dial("unix", getSocketPath(session))
+	return sessionCommand(session, nil, "send", window, pane, command+"\n")
+}
+
+// WaitSession waits for a pane as described by opts, with the server
+// streaming the pane's screen instead of txm polling it. The server hanging
+// up means the session ended with its last process.
+func (b *NativeBackend) WaitSession(session string, opts WaitOptions) error {
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	fc, err := dialSession(session)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = conn.Close() }()
+	defer func() { _ = fc.Close() }()
 
-	payload := append([]byte{0x01}, []byte(command+"\n")...)
-	_, err = conn.Write(payload)
-	return err
+	req, err := json.Marshal(Watch{Window: opts.Window, Pane: opts.Pane})
+	if err != nil {
+		return err
+	}
+	if err := fc.WriteFrame(MsgWatch, req); err != nil {
+		return err
+	}
+
+	// states is closed when the server hangs up, and failed receives an
+	// error reply instead of a state.
+	states := make(chan PaneState)
+	failed := make(chan error, 1)
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		defer close(states)
+		for {
+			typ, payload, err := fc.ReadFrame()
+			if err != nil {
+				return
+			}
+			var st PaneState
+			if typ == MsgError {
+				failed <- fmt.Errorf("%s", payload)
+				return
+			} else if typ != MsgWatch || json.Unmarshal(payload, &st) != nil {
+				failed <- fmt.Errorf("malformed reply from session server")
+				return
+			}
+			select {
+			case states <- st:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var timeout <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	cond := &waitCondition{opts: opts}
+	screen := ""
+	for {
+		var idle <-chan time.Time
+		if deadline := cond.idleDeadline(); !deadline.IsZero() {
+			idle = time.After(time.Until(deadline))
+		}
+
+		var done bool
+		select {
+		case st, ok := <-states:
+			if !ok {
+				select {
+				case err := <-failed:
+					return err
+				default:
+				}
+				st = PaneState{Screen: screen, Exited: true}
+			}
+			screen = st.Screen
+			done, err = cond.observe(st.Screen, st.Exited, time.Now())
+		case <-idle:
+			done, err = cond.observe(screen, false, time.Now())
+		case <-timeout:
+			return ErrWaitTimeout
+		}
+		if done || err != nil {
+			return err
+		}
+	}
+}
+
+// SendKeys types keys into a pane, encoded as a terminal would send them.
+func (b *NativeBackend) SendKeys(session, window, pane string, keys []Key) error {
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session %s does not exist", session)
+	}
+	var data []byte
+	for _, k := range keys {
+		data = append(data, k.Data...)
+	}
+	return sessionCommand(session, nil, "send", window, pane, string(data))
+}
+
+// CapturePane returns the pane's scrollback and screen as plain text,
+// rendered by its terminal.
+func (b *NativeBackend) CapturePane(session, window, pane string) (string, error) {
+	if !b.SessionExists(session) {
+		return "", fmt.Errorf("session %s does not exist", session)
+	}
+	var text string
+	err := sessionCommand(session, &text, "capture-pane", window, pane)
+	return text, err
 }
 
 func (b *NativeBackend) NukeAllSessions() error {
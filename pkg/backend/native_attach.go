@@ -0,0 +1,482 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errDetached ends an attachment the user asked to leave.
+var errDetached = errors.New("detached")
+
+// errSessionEnded and errConnectionLost tell why the server went away: the
+// session ended, or the connection broke or stopped answering heartbeats.
+// errKicked means another client forced this one off.
+var (
+	errSessionEnded   = errors.New("session ended")
+	errConnectionLost = errors.New("connection lost")
+	errKicked         = errors.New("detached by another client")
+)
+
+// Reconnection attempts back off from reconnectMinDelay to
+// reconnectMaxDelay.
+const (
+	reconnectMinDelay = 500 * time.Millisecond
+	reconnectMaxDelay = 10 * time.Second
+)
+
+// stdinChunk is one read from the user's terminal.
+type stdinChunk struct {
+	data []byte
+	err  error
+}
+
+// attachMode says how the attach client interprets the next key.
+type attachMode int
+
+const (
+	modeNormal     attachMode = iota // keys go to the session
+	modePrefix                       // the prefix was pressed, the next key picks a command
+	modeHelp                         // the help overlay is shown
+	modeSwitch                       // the session switcher is shown
+	modeScrollback                   // the scrollback viewer is shown
+)
+
+// prefixBindings lists the commands available after the prefix key, in the
+// order the help overlay shows them.
+var prefixBindings = []struct {
+	keys     string
+	help     string
+	readOnly bool // available to read-only clients
+}{
+	{"d", "detach", true},
+	{"", "send the prefix key to the session", false},
+	{"[", "copy mode: scroll, search and copy", true},
+	{"]", "paste the most recent buffer", false},
+	{"s", "switch to another session", true},
+	{"c", "new window", false},
+	{"n/p", "next/previous window", false},
+	{"o", "next pane", false},
+	{"?", "show this help", true},
+}
+
+// switchKeys label the sessions offered by the session switcher.
+const switchKeys = "123456789abcdefghijklmnopqrstuvwxyz"
+
+// attachClient is the interactive side of a native session. Keys are passed
+// to the session until the prefix key is pressed; the key after it picks a
+// command from prefixBindings instead.
+type attachClient struct {
+	b        *NativeBackend
+	fd       int
+	input    <-chan stdinChunk
+	readOnly bool
+
+	// reconnect dials the session again when the connection is lost.
+	// signals delivers the signals that end the client.
+	reconnect bool
+	signals   <-chan os.Signal
+
+	// detachOthers detaches every other client of the first session
+	// attached to. tty names the user's terminal for txm clients. sync
+	// asks for synchronized rendering, see Attach.
+	detachOthers bool
+	tty          string
+	sync         bool
+
+	// dial connects to a session, either through its local socket or
+	// through a --via command, in which case remote is set.
+	dial   func(name string, hello Hello) (*FrameConn, error)
+	remote bool
+
+	name string
+	fc   *FrameConn
+	mode attachMode
+
+	targets []string        // sessions offered by the session switcher
+	view    *scrollbackView // active in modeScrollback
+
+	// outMu serializes writes to the terminal. While paused, session
+	// output is dropped because an overlay owns the screen; the screen is
+	// redrawn from a fresh dump when the overlay closes.
+	outMu  sync.Mutex
+	paused bool
+}
+
+// run attaches to a session and follows the user's switches to other
+// sessions, reconnecting when enabled, until the user detaches or a session
+// ends.
+func (a *attachClient) run(name string) error {
+	var fc *FrameConn
+	for {
+		next, err := a.attach(name, fc)
+		fc = nil
+		if errors.Is(err, errConnectionLost) && a.reconnect {
+			if fc, err = a.redial(name); err == nil {
+				continue
+			}
+		}
+		if err != nil || next == "" {
+			return err
+		}
+		name = next
+	}
+}
+
+// redial connects to a session again after the connection was lost,
+// backing off between attempts until it succeeds, the session turns out to
+// be gone or the user gives up with Ctrl-C.
+func (a *attachClient) redial(name string) (*FrameConn, error) {
+	_, _ = fmt.Fprintf(os.Stdout, "\r\n[txm: lost the connection to %s, reconnecting; press Ctrl-C to give up]\r\n", name)
+	delay := reconnectMinDelay
+	for {
+		if !a.remote && !a.b.SessionExists(name) {
+			return nil, errSessionEnded
+		}
+		if fc, err := a.dial(name, Hello{ReadOnly: a.readOnly}); err == nil {
+			return fc, nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case sig := <-a.signals:
+			timer.Stop()
+			return nil, fmt.Errorf("terminated by %v", sig)
+		case chunk := <-a.input:
+			timer.Stop()
+			if chunk.err != nil || bytes.IndexByte(chunk.data, 0x03) >= 0 {
+				return nil, errConnectionLost
+			}
+		}
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+// attach relays the terminal to a session until the user detaches, the
+// session ends or the connection is lost. fc is an established connection
+// to the session, or nil to dial it. When the user switches to another
+// session its name is returned.
+func (a *attachClient) attach(name string, fc *FrameConn) (string, error) {
+	redraw := fc != nil
+	if fc == nil {
+		var err error
+		if fc, err = a.dial(name, Hello{ReadOnly: a.readOnly}); err != nil {
+			return "", fmt.Errorf("failed to connect to session: %v", err)
+		}
+	}
+	defer func() { _ = fc.Close() }()
+
+	if redraw {
+		// The server starts with a fresh snapshot of the screen.
+		_, _ = io.WriteString(os.Stdout, "\x1b[H\x1b[2J")
+	}
+
+	attach, err := json.Marshal(Attach{TTY: a.tty, DetachOthers: a.detachOthers, Sync: a.sync})
+	if err != nil {
+		return "", err
+	}
+	if err := fc.WriteFrame(MsgAttach, attach); err != nil {
+		return "", fmt.Errorf("failed to attach to session: %v", err)
+	}
+	a.detachOthers = false
+
+	a.name, a.fc, a.mode = name, fc, modeNormal
+	a.outMu.Lock()
+	a.paused = false
+	a.outMu.Unlock()
+
+	stop := watchWindowSize(a.fd, fc)
+	defer stop()
+
+	done := make(chan error, 1)
+	go a.copyOutput(fc, done)
+
+	for {
+		select {
+		case err := <-done:
+			return "", a.disconnected(name, err)
+		case sig := <-a.signals:
+			return "", fmt.Errorf("terminated by %v", sig)
+		case chunk := <-a.input:
+			next, err := a.handleInput(chunk.data)
+			if errors.Is(err, errDetached) || chunk.err == io.EOF {
+				return "", nil
+			}
+			err = a.disconnected(name, err)
+			if err == nil {
+				err = chunk.err
+			}
+			if err != nil || next != "" {
+				return next, err
+			}
+		}
+	}
+}
+
+// disconnected tells why the attachment ended: errSessionEnded or
+// errConnectionLost for a failed connection, or err itself. Servers that do
+// not announce the end of the session just hang up, and a local session
+// whose socket is gone has ended either way.
+func (a *attachClient) disconnected(name string, err error) error {
+	var ce *connError
+	if !errors.As(err, &ce) {
+		return err
+	}
+	if !a.remote && !a.b.SessionExists(name) {
+		return errSessionEnded
+	}
+	return errConnectionLost
+}
+
+// connError is a failure to read from or write to the session's
+// connection, as opposed to the terminal.
+type connError struct{ err error }
+
+func (e *connError) Error() string { return e.err.Error() }
+
+// send writes a frame to the session, marking failures as connError.
+func (a *attachClient) send(typ byte, payload []byte) error {
+	if err := a.fc.WriteFrame(typ, payload); err != nil {
+		return &connError{err}
+	}
+	return nil
+}
+
+// copyOutput writes the session's output to the terminal until the server
+// ends the attachment. Once the server has sent a heartbeat, the
+// connection is closed when nothing arrives for HeartbeatTimeout.
+func (a *attachClient) copyOutput(fc *FrameConn, done chan<- error) {
+	var watchdog *time.Timer
+	defer func() {
+		if watchdog != nil {
+			watchdog.Stop()
+		}
+	}()
+
+	for {
+		typ, payload, err := fc.ReadFrame()
+		if err != nil {
+			done <- &connError{err}
+			return
+		}
+		if watchdog != nil {
+			watchdog.Reset(HeartbeatTimeout)
+		}
+		switch typ {
+		case MsgPing:
+			if watchdog == nil {
+				watchdog = time.AfterFunc(HeartbeatTimeout, func() { _ = fc.Close() })
+			}
+			if err := fc.WriteFrame(MsgPong, nil); err != nil {
+				done <- &connError{err}
+				return
+			}
+		case MsgOutput:
+			err = a.writeOutput("", payload)
+		case MsgDump:
+			// Answer to the redraw request sent when an overlay closes.
+			err = a.writeOutput("\x1b[H\x1b[2J", payload)
+		case MsgDetach:
+			switch string(payload) {
+			case DetachExited:
+				done <- errSessionEnded
+			case DetachKicked:
+				done <- errKicked
+			default:
+				done <- nil
+			}
+			return
+		case MsgError:
+			done <- fmt.Errorf("%s", payload)
+			return
+		}
+		if err != nil {
+			done <- err
+			return
+		}
+	}
+}
+
+func (a *attachClient) writeOutput(prefix string, data []byte) error {
+	a.outMu.Lock()
+	defer a.outMu.Unlock()
+	if a.paused {
+		return nil
+	}
+	if prefix != "" {
+		if _, err := io.WriteString(os.Stdout, prefix); err != nil {
+			return err
+		}
+	}
+	_, err := os.Stdout.Write(data)
+	return err
+}
+
+// handleInput forwards keys to the session and runs prefix commands. It
+// returns the name of a session to switch to, if one was picked.
+func (a *attachClient) handleInput(data []byte) (string, error) {
+	start := 0
+	flush := func(end int) error {
+		if a.readOnly || end <= start {
+			return nil
+		}
+		return a.send(MsgInput, data[start:end])
+	}
+
+	for i := 0; i < len(data); i++ {
+		key := data[i]
+		switch a.mode {
+		case modeNormal:
+			if key != a.b.prefix {
+				continue
+			}
+			if err := flush(i); err != nil {
+				return "", err
+			}
+			a.mode = modePrefix
+		case modePrefix:
+			a.mode = modeNormal
+			if key == 0x1b {
+				// Escape cancels; drop the rest of an escape sequence.
+				return "", nil
+			}
+			next, err := a.command(key)
+			if err != nil || next != "" {
+				return next, err
+			}
+		case modeHelp:
+			// Any key closes the help, including a whole escape sequence.
+			return "", a.closeOverlay()
+		case modeSwitch:
+			if idx := strings.IndexByte(switchKeys, key); idx >= 0 && idx < len(a.targets) {
+				return a.targets[idx], nil
+			}
+			return "", a.closeOverlay()
+		case modeScrollback:
+			if a.view.handleKeys(data[i:]) {
+				return "", a.closeOverlay()
+			}
+			return "", nil
+		}
+		start = i + 1
+	}
+	return "", flush(len(data))
+}
+
+// command runs the command bound to key in prefixBindings.
+func (a *attachClient) command(key byte) (string, error) {
+	switch {
+	case key == 'd':
+		return "", errDetached
+	case key == '[':
+		return "", a.openScrollback()
+	case key == 's':
+		return "", a.openSwitcher()
+	case key == '?':
+		return "", a.openHelp()
+	case a.readOnly:
+		return "", nil
+	case key == a.b.prefix:
+		return "", a.send(MsgInput, []byte{key})
+	case key == ']':
+		a.sessionCommand("paste-buffer", "0")
+	case key == 'c':
+		a.sessionCommand("new-window")
+	case key == 'n':
+		a.sessionCommand("select-window", "next")
+	case key == 'p':
+		a.sessionCommand("select-window", "prev")
+	case key == 'o':
+		a.sessionCommand("select-pane", "", "next")
+	}
+	return "", nil
+}
+
+// sessionCommand runs a control command on the attached session and rings
+// the bell if it fails.
+func (a *attachClient) sessionCommand(name string, args ...string) {
+	if err := a.runCommand(nil, name, args...); err != nil {
+		_ = a.writeOutput("", []byte("\a"))
+	}
+}
+
+// runCommand runs a control command on the attached session over a
+// separate connection, so its reply cannot interleave with output.
+func (a *attachClient) runCommand(out interface{}, name string, args ...string) error {
+	fc, err := a.dial(a.name, Hello{ReadOnly: a.readOnly})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fc.Close() }()
+	return sendCommand(fc, out, name, args...)
+}
+
+// showOverlay pauses session output and replaces the screen with text.
+func (a *attachClient) showOverlay(mode attachMode, lines []string) error {
+	a.outMu.Lock()
+	defer a.outMu.Unlock()
+	a.mode = mode
+	a.paused = true
+	_, err := io.WriteString(os.Stdout, "\x1b[H\x1b[2J"+strings.Join(lines, "\r\n"))
+	return err
+}
+
+// closeOverlay resumes session output and asks the server for the current
+// screen, which copyOutput draws over the overlay.
+func (a *attachClient) closeOverlay() error {
+	a.outMu.Lock()
+	a.mode = modeNormal
+	a.paused = false
+	a.view = nil
+	a.outMu.Unlock()
+	return a.send(MsgDump, nil)
+}
+
+func (a *attachClient) openHelp() error {
+	lines := []string{fmt.Sprintf("txm: commands follow the prefix key %s", a.b.prefixName), ""}
+	for _, binding := range prefixBindings {
+		if a.readOnly && !binding.readOnly {
+			continue
+		}
+		keys := binding.keys
+		if keys == "" {
+			keys = a.b.prefixName
+		}
+		lines = append(lines, fmt.Sprintf("  %s %-6s %s", a.b.prefixName, keys, binding.help))
+	}
+	lines = append(lines, "", "Press any key to return to the session.")
+	return a.showOverlay(modeHelp, lines)
+}
+
+func (a *attachClient) openSwitcher() error {
+	if a.remote {
+		return a.showOverlay(modeHelp, []string{"txm: switching sessions is not available with --via", "", "Press any key to return to the session."})
+	}
+	sessions, err := a.b.GetSessions()
+	if err != nil {
+		return err
+	}
+	a.targets = a.targets[:0]
+	for _, s := range sessions {
+		if s != a.name && len(a.targets) < len(switchKeys) {
+			a.targets = append(a.targets, s)
+		}
+	}
+	if len(a.targets) == 0 {
+		return a.showOverlay(modeHelp, []string{"txm: there are no other sessions", "", "Press any key to return to the session."})
+	}
+
+	lines := []string{"txm: switch to session", ""}
+	for i, s := range a.targets {
+		lines = append(lines, fmt.Sprintf("  %c  %s", switchKeys[i], s))
+	}
+	lines = append(lines, "", "Press another key to stay in "+a.name+".")
+	return a.showOverlay(modeSwitch, lines)
+}
@@ -0,0 +1,155 @@
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+type bufferConn struct{ bytes.Buffer }
+
+func (*bufferConn) Close() error { return nil }
+
+func TestAttachPrefixKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []string
+		readOnly bool
+		input    []string
+		detached bool
+	}{
+		{"Plain input", []string{"ls\r"}, false, []string{"ls\r"}, false},
+		{"Detach", []string{"ab\x1cd"}, false, []string{"ab"}, true},
+		{"Literal prefix", []string{"\x1c\x1cb"}, false, []string{"\x1c", "b"}, false},
+		{"Prefix across reads", []string{"x\x1c", "d"}, false, []string{"x"}, true},
+		{"Escape cancels", []string{"\x1c\x1b[A", "y"}, false, []string{"y"}, false},
+		{"Read-only drops input", []string{"ls\x1c\x1c", "\x1cd"}, true, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &bufferConn{}
+			a := &attachClient{
+				b:        NewNativeBackend(),
+				fc:       NewFrameConn(conn),
+				readOnly: tt.readOnly,
+			}
+
+			var err error
+			for _, chunk := range tt.chunks {
+				if _, err = a.handleInput([]byte(chunk)); err != nil {
+					break
+				}
+			}
+			if detached := errors.Is(err, errDetached); detached != tt.detached {
+				t.Errorf("detached = %v (err %v); want %v", detached, err, tt.detached)
+			}
+
+			var input []string
+			for {
+				typ, payload, err := a.fc.ReadFrame()
+				if err == io.EOF {
+					break
+				}
+				if err != nil || typ != MsgInput {
+					t.Fatalf("unexpected frame 0x%02x: %v", typ, err)
+				}
+				input = append(input, string(payload))
+			}
+			if len(input) != len(tt.input) {
+				t.Fatalf("sent %q; want %q", input, tt.input)
+			}
+			for i := range input {
+				if input[i] != tt.input[i] {
+					t.Errorf("sent %q; want %q", input, tt.input)
+				}
+			}
+		})
+	}
+}
+
+func TestAttachDisconnect(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		end  func(*FrameConn)
+		want error
+	}{
+		{"Session ended", func(fc *FrameConn) { _ = fc.WriteFrame(MsgDetach, []byte(DetachExited)) }, errSessionEnded},
+		{"Detached", func(fc *FrameConn) { _ = fc.WriteFrame(MsgDetach, nil) }, nil},
+		{"Connection lost", func(fc *FrameConn) { _ = fc.Close() }, errConnectionLost},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer func() { _ = client.Close() }()
+			a := &attachClient{b: NewNativeBackend(), remote: true}
+			done := make(chan error, 1)
+			go a.copyOutput(NewFrameConn(client), done)
+
+			// Heartbeats are answered.
+			fs := NewFrameConn(server)
+			go func() { _ = fs.WriteFrame(MsgPing, nil) }()
+			if typ, _, err := fs.ReadFrame(); err != nil || typ != MsgPong {
+				t.Fatalf("answered a ping with 0x%02x (%v); want a pong", typ, err)
+			}
+
+			go tt.end(fs)
+			if err := a.disconnected("s", <-done); err != tt.want {
+				t.Errorf("disconnected = %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyMode(t *testing.T) {
+	v := &scrollbackView{lines: []string{"alpha beta", "Gamma delta  ", "beta end"}}
+
+	for _, step := range []struct {
+		query  string
+		back   bool
+		cy, cx int
+	}{
+		{"beta", false, 0, 6},
+		{"beta", false, 2, 0},
+		{"beta", false, 0, 6}, // wraps around
+		{"beta", true, 2, 0},
+		{"gamma", false, 1, 0}, // lower case matches any case
+		{"Beta", false, 1, 0},  // upper case does not
+	} {
+		v.search(step.query, step.back)
+		if v.cy != step.cy || v.cx != step.cx {
+			t.Errorf("search(%q, back=%v) moved to %d:%d; want %d:%d", step.query, step.back, v.cy, v.cx, step.cy, step.cx)
+		}
+	}
+
+	v.cy, v.cx = 0, 6
+	for _, key := range []string{"v", "j", "l"} {
+		v.viKey(key)
+	}
+	if got, want := v.selection(), "beta\nGamma de"; got != want {
+		t.Errorf("character selection = %q; want %q", got, want)
+	}
+	v.viKey("V")
+	if got, want := v.selection(), "alpha beta\nGamma delta\n"; got != want {
+		t.Errorf("line selection = %q; want %q", got, want)
+	}
+
+	for data, keys := range map[string][]string{
+		"\x1b[A\x1bvq": {"\x1b[A", "\x1bv", "q"},
+		"\x1bOB\x1b":   {"\x1bOB", "\x1b"},
+		"é\x1b[5~":     {"é", "\x1b[5~"},
+	} {
+		var got []string
+		rest := []byte(data)
+		for len(rest) > 0 {
+			var key string
+			key, rest = nextKey(rest)
+			got = append(got, key)
+		}
+		if strings.Join(got, "|") != strings.Join(keys, "|") {
+			t.Errorf("nextKey split %q into %q; want %q", data, got, keys)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// `txm proxy` relays a native session's socket over its stdin and stdout,
+// and `txm attach --via` runs such a proxy, usually on another machine, to
+// reach the session. The attach client then runs locally and the protocol
+// travels over whatever byte stream the command provides, so resizing and
+// the prefix key behave the same over ssh, kubectl exec or docker exec.
+
+// ProxySession copies bytes between a session's socket and the given
+// streams until the server hangs up.
+func ProxySession(name string, stdin io.Reader, stdout io.Writer) error {
+	conn, err := dialSocket(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	go func() {
+		_, _ = io.Copy(conn, stdin)
+		// Let the server see the end of the input while its replies are
+		// still being relayed.
+		if uc, ok := conn.(*net.UnixConn); ok {
+			_ = uc.CloseWrite()
+		}
+	}()
+	_, err = io.Copy(stdout, conn)
+	return err
+}
+
+// viaConn is the stdio of a proxy command seen as one stream.
+type viaConn struct {
+	cmd *exec.Cmd
+	io.WriteCloser
+	io.ReadCloser
+}
+
+// Close ends the proxy command, which exits once its stdin is closed.
+func (c *viaConn) Close() error {
+	err := c.WriteCloser.Close()
+	_ = c.ReadCloser.Close()
+	_ = c.cmd.Wait()
+	return err
+}
+
+// errEmptyVia rejects a --via without a command, which would otherwise run
+// the session name as the command.
+var errEmptyVia = errors.New(`--via needs a command that runs txm proxy, such as "ssh host txm proxy"`)
+
+// dialVia starts the proxy command via with the session name appended and
+// performs the handshake over its stdin and stdout. The command line is
+// split on whitespace; it is not interpreted by a shell.
+func dialVia(via, name string, hello Hello) (*FrameConn, error) {
+	fields := strings.Fields(via)
+	if len(fields) == 0 {
+		return nil, errEmptyVia
+	}
+	argv := append(fields, name)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run %s: %v", argv[0], err)
+	}
+
+	fc := NewFrameConn(&viaConn{cmd: cmd, WriteCloser: stdin, ReadCloser: stdout})
+	if _, err := fc.ClientHello(hello); err != nil {
+		_ = fc.Close()
+		if errors.Is(err, ErrLegacyServer) {
+			err = fmt.Errorf("%q did not answer the protocol handshake; check that it ends in `txm proxy` and that the session exists on the other side", via)
+		}
+		return nil, err
+	}
+	return fc, nil
+}
@@ -0,0 +1,11 @@
+package backend
+
+import "testing"
+
+func TestDialViaEmpty(t *testing.T) {
+	for _, via := range []string{"", "  \t"} {
+		if _, err := dialVia(via, "work", Hello{}); err != errEmptyVia {
+			t.Errorf("dialVia(%q) = %v; want %v", via, err, errEmptyVia)
+		}
+	}
+}
@@ -0,0 +1,572 @@
+package backend
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// scrollbackView is the copy mode of the attach client. It pages through the
+// plain text of the active pane, including the scrollback the server keeps
+// for it, while live output is paused. A cursor can be moved around, text
+// searched and selected, and the selection copied to the host clipboard with
+// OSC 52 and into the session's paste buffers.
+type scrollbackView struct {
+	a      *attachClient
+	emacs  bool // emacs key bindings instead of vi ones
+	lines  []string
+	top    int
+	height int
+
+	cy, cx int // cursor line and column in runes
+
+	selecting  bool
+	lineSelect bool
+	my, mx     int // where the selection started
+
+	// prompt is the search being typed, or nil. searchBack says which way
+	// the search runs; query is the last search, repeated by n and N.
+	prompt     *string
+	searchBack bool
+	query      string
+
+	message string
+}
+
+// openScrollback fetches the active pane's text and shows its end.
+func (a *attachClient) openScrollback() error {
+	var text string
+	if err := a.runCommand(&text, "capture-pane", "", ""); err != nil {
+		return a.writeOutput("", []byte("\a"))
+	}
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	for len(lines) > 1 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	a.view = &scrollbackView{
+		a:     a,
+		emacs: a.b.emacsKeys,
+		lines: lines,
+		top:   len(lines),
+		cy:    len(lines) - 1,
+	}
+	return a.view.draw()
+}
+
+// handleKeys applies keys read from the terminal and reports whether the
+// user left the view.
+func (v *scrollbackView) handleKeys(data []byte) bool {
+	for len(data) > 0 {
+		var key string
+		key, data = nextKey(data)
+		v.message = ""
+
+		var done bool
+		switch {
+		case v.prompt != nil:
+			v.promptKey(key)
+		case v.moveKey(key):
+		case v.emacs:
+			done = v.emacsKey(key)
+		default:
+			done = v.viKey(key)
+		}
+		if done {
+			return true
+		}
+	}
+	v.follow()
+	_ = v.draw()
+	return false
+}
+
+// nextKey splits the first key off terminal input: an escape sequence, an
+// Alt-modified key or a single character.
+func nextKey(data []byte) (string, []byte) {
+	if data[0] != 0x1b || len(data) == 1 {
+		_, n := utf8.DecodeRune(data)
+		return string(data[:n]), data[n:]
+	}
+	switch data[1] {
+	case 'O':
+		n := min(3, len(data))
+		return string(data[:n]), data[n:]
+	case '[':
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				return string(data[:i+1]), data[i+1:]
+			}
+		}
+		return string(data), nil
+	}
+	return string(data[:2]), data[2:]
+}
+
+// moveKey handles the keys both binding sets share: arrows and the paging
+// keys of the keyboard.
+func (v *scrollbackView) moveKey(key string) bool {
+	switch key {
+	case "\x1b[A", "\x1bOA":
+		v.moveLines(-1)
+	case "\x1b[B", "\x1bOB":
+		v.moveLines(1)
+	case "\x1b[D", "\x1bOD":
+		v.cx = max(v.cx-1, 0)
+	case "\x1b[C", "\x1bOC":
+		v.cx = min(v.cx+1, v.lineLen(v.cy))
+	case "\x1b[5~":
+		v.scroll(-v.height)
+	case "\x1b[6~":
+		v.scroll(v.height)
+	case "\x1b[H", "\x1b[1~", "\x1bOH":
+		v.cy, v.cx = 0, 0
+	case "\x1b[F", "\x1b[4~", "\x1bOF":
+		v.cy, v.cx = len(v.lines)-1, 0
+	default:
+		return false
+	}
+	return true
+}
+
+// viKey applies a key of the vi bindings and reports whether the view
+// should close.
+func (v *scrollbackView) viKey(key string) bool {
+	switch key {
+	case "q":
+		return true
+	case "\x1b", "\x03":
+		if !v.selecting {
+			return true
+		}
+		v.selecting = false
+	case "h", "\x7f":
+		v.cx = max(v.cx-1, 0)
+	case "l":
+		v.cx = min(v.cx+1, v.lineLen(v.cy))
+	case "k", "\x10":
+		v.moveLines(-1)
+	case "j", "\x0e":
+		v.moveLines(1)
+	case "\x02":
+		v.scroll(-v.height)
+	case "\x06":
+		v.scroll(v.height)
+	case "\x15":
+		v.scroll(-v.height / 2)
+	case "\x04":
+		v.scroll(v.height / 2)
+	case "\x19":
+		v.scroll(-1)
+	case "\x05":
+		v.scroll(1)
+	case "g":
+		v.cy, v.cx = 0, 0
+	case "G":
+		v.cy, v.cx = len(v.lines)-1, 0
+	case "H":
+		v.moveTo(v.top)
+	case "M":
+		v.moveTo(v.top + min(v.height, len(v.lines)-v.top)/2)
+	case "L":
+		v.moveTo(v.top + v.height - 1)
+	case "0":
+		v.cx = 0
+	case "^":
+		v.cx = v.indent(v.cy)
+	case "$":
+		v.cx = max(v.lineLen(v.cy)-1, 0)
+	case "w":
+		v.wordForward()
+	case "b":
+		v.wordBackward()
+	case "v", " ":
+		v.startSelection(false)
+	case "V":
+		v.startSelection(true)
+	case "y", "\r":
+		return v.copySelection()
+	case "/":
+		v.openPrompt(false)
+	case "?":
+		v.openPrompt(true)
+	case "n":
+		v.search(v.query, v.searchBack)
+	case "N":
+		v.search(v.query, !v.searchBack)
+	}
+	return false
+}
+
+// emacsKey applies a key of the emacs bindings and reports whether the view
+// should close.
+func (v *scrollbackView) emacsKey(key string) bool {
+	switch key {
+	case "q", "\x1b":
+		return true
+	case "\x07", "\x03":
+		if !v.selecting {
+			return true
+		}
+		v.selecting = false
+	case "\x02":
+		v.cx = max(v.cx-1, 0)
+	case "\x06":
+		v.cx = min(v.cx+1, v.lineLen(v.cy))
+	case "\x10":
+		v.moveLines(-1)
+	case "\x0e":
+		v.moveLines(1)
+	case "\x1bv":
+		v.scroll(-v.height)
+	case "\x16":
+		v.scroll(v.height)
+	case "\x1b<":
+		v.cy, v.cx = 0, 0
+	case "\x1b>":
+		v.cy, v.cx = len(v.lines)-1, 0
+	case "\x01":
+		v.cx = 0
+	case "\x05":
+		v.cx = v.lineLen(v.cy)
+	case "\x1bm":
+		v.cx = v.indent(v.cy)
+	case "\x1bf":
+		v.wordForward()
+	case "\x1bb":
+		v.wordBackward()
+	case "\x00":
+		v.startSelection(false)
+	case "\x1bw", "\x17", "\r":
+		return v.copySelection()
+	case "\x13":
+		v.openPrompt(false)
+	case "\x12":
+		v.openPrompt(true)
+	}
+	return false
+}
+
+// promptKey edits the search being typed. An empty search repeats the last
+// one; in the emacs bindings C-s and C-r run it in their direction.
+func (v *scrollbackView) promptKey(key string) {
+	switch key {
+	case "\r", "\x13", "\x12":
+		query := *v.prompt
+		if query == "" {
+			query = v.query
+		}
+		if key != "\r" {
+			v.searchBack = key == "\x12"
+		}
+		v.prompt = nil
+		v.search(query, v.searchBack)
+	case "\x1b", "\x03", "\x07":
+		v.prompt = nil
+	case "\x7f", "\x08":
+		s := *v.prompt
+		_, n := utf8.DecodeLastRuneInString(s)
+		*v.prompt = s[:len(s)-n]
+	default:
+		if r, n := utf8.DecodeRuneInString(key); n == len(key) && unicode.IsPrint(r) {
+			*v.prompt += key
+		}
+	}
+}
+
+func (v *scrollbackView) openPrompt(back bool) {
+	s := ""
+	v.prompt, v.searchBack = &s, back
+}
+
+// search moves the cursor to the next match of query, wrapping around the
+// ends of the scrollback. A query without upper case letters matches
+// regardless of case.
+func (v *scrollbackView) search(query string, back bool) {
+	if query == "" {
+		return
+	}
+	v.query = query
+	fold := strings.ToLower(query) == query
+
+	n := len(v.lines)
+	for k := 0; k <= n; k++ {
+		var i, j int
+		var line string
+		if back {
+			i = ((v.cy-k)%n + n) % n
+			line = v.lines[i]
+			if fold {
+				line = strings.ToLower(line)
+			}
+			end := len(line)
+			if k == 0 {
+				end = byteOffset(line, v.cx)
+			}
+			j = strings.LastIndex(line[:end], query)
+		} else {
+			i = (v.cy + k) % n
+			line = v.lines[i]
+			if fold {
+				line = strings.ToLower(line)
+			}
+			start := 0
+			if k == 0 {
+				start = byteOffset(line, v.cx+1)
+			}
+			if j = strings.Index(line[start:], query); j >= 0 {
+				j += start
+			}
+		}
+		if j >= 0 {
+			v.cy, v.cx = i, utf8.RuneCountInString(line[:j])
+			return
+		}
+	}
+	v.message = "not found: " + query
+}
+
+// byteOffset converts a rune column of s into a byte offset.
+func byteOffset(s string, col int) int {
+	for i := range s {
+		if col == 0 {
+			return i
+		}
+		col--
+	}
+	return len(s)
+}
+
+func (v *scrollbackView) lineLen(i int) int {
+	return utf8.RuneCountInString(v.lines[i])
+}
+
+// indent returns the column of the first non-blank character of line i.
+func (v *scrollbackView) indent(i int) int {
+	line := v.lines[i]
+	return utf8.RuneCountInString(line[:len(line)-len(strings.TrimLeft(line, " \t"))])
+}
+
+func (v *scrollbackView) moveTo(line int) {
+	v.cy = max(min(line, len(v.lines)-1), 0)
+	v.cx = min(v.cx, v.lineLen(v.cy))
+}
+
+func (v *scrollbackView) moveLines(n int) {
+	v.moveTo(v.cy + n)
+}
+
+// scroll moves both the view and the cursor by n lines.
+func (v *scrollbackView) scroll(n int) {
+	v.top += n
+	v.moveLines(n)
+}
+
+func (v *scrollbackView) wordForward() {
+	runes := []rune(v.lines[v.cy])
+	x := v.cx
+	for x < len(runes) && !unicode.IsSpace(runes[x]) {
+		x++
+	}
+	for x < len(runes) && unicode.IsSpace(runes[x]) {
+		x++
+	}
+	if x >= len(runes) && v.cy < len(v.lines)-1 {
+		v.cy++
+		v.cx = v.indent(v.cy)
+		return
+	}
+	v.cx = min(x, len(runes))
+}
+
+func (v *scrollbackView) wordBackward() {
+	runes := []rune(v.lines[v.cy])
+	x := min(v.cx, len(runes))
+	if x == 0 && v.cy > 0 {
+		v.cy--
+		runes = []rune(v.lines[v.cy])
+		x = len(runes)
+	}
+	for x > 0 && unicode.IsSpace(runes[x-1]) {
+		x--
+	}
+	for x > 0 && !unicode.IsSpace(runes[x-1]) {
+		x--
+	}
+	v.cx = x
+}
+
+// follow scrolls the view so that the cursor is visible.
+func (v *scrollbackView) follow() {
+	if v.cy < v.top {
+		v.top = v.cy
+	} else if v.height > 0 && v.cy >= v.top+v.height {
+		v.top = v.cy - v.height + 1
+	}
+}
+
+// startSelection starts a selection at the cursor, switches an ongoing one
+// between character and line mode, or cancels it when the key of its own
+// mode is pressed again.
+func (v *scrollbackView) startSelection(lines bool) {
+	if v.selecting && v.lineSelect == lines {
+		v.selecting = false
+		return
+	}
+	if !v.selecting {
+		v.my, v.mx = v.cy, v.cx
+	}
+	v.selecting, v.lineSelect = true, lines
+}
+
+// selectionBounds returns the ordered ends of the selection, both included.
+func (v *scrollbackView) selectionBounds() (sy, sx, ey, ex int) {
+	sy, sx, ey, ex = v.my, v.mx, v.cy, v.cx
+	if ey < sy || (ey == sy && ex < sx) {
+		sy, sx, ey, ex = ey, ex, sy, sx
+	}
+	return sy, sx, ey, ex
+}
+
+// selectedColumns returns the selected runes of line i as a half-open
+// range.
+func (v *scrollbackView) selectedColumns(i int) (int, int) {
+	if !v.selecting {
+		return 0, 0
+	}
+	sy, sx, ey, ex := v.selectionBounds()
+	if i < sy || i > ey {
+		return 0, 0
+	}
+	from, to := 0, v.lineLen(i)
+	if !v.lineSelect {
+		if i == sy {
+			from = min(sx, to)
+		}
+		if i == ey {
+			to = min(ex+1, to)
+		}
+	}
+	return from, max(from, to)
+}
+
+// selection returns the selected text without the padding the terminal
+// leaves at the end of each line.
+func (v *scrollbackView) selection() string {
+	sy, _, ey, _ := v.selectionBounds()
+	var out []string
+	for i := sy; i <= ey; i++ {
+		from, to := v.selectedColumns(i)
+		out = append(out, strings.TrimRight(string([]rune(v.lines[i])[from:to]), " "))
+	}
+	text := strings.Join(out, "\n")
+	if v.lineSelect {
+		text += "\n"
+	}
+	return text
+}
+
+// copySelection puts the selection on the host clipboard with OSC 52 and
+// into the session's paste buffers, and reports whether the view should
+// close. Read-only clients only get the clipboard copy, since buffers can
+// be pasted into the session.
+func (v *scrollbackView) copySelection() bool {
+	if !v.selecting {
+		v.message = "nothing selected"
+		return false
+	}
+	text := v.selection()
+	osc := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	v.a.outMu.Lock()
+	_, _ = fmt.Print(osc)
+	v.a.outMu.Unlock()
+	if !v.a.readOnly {
+		_ = v.a.runCommand(nil, "set-buffer", text)
+	}
+	return true
+}
+
+// draw shows the lines starting at top above a status line, with the cursor
+// and the selection in reverse video.
+func (v *scrollbackView) draw() error {
+	cols, rows, err := term.GetSize(v.a.fd)
+	if err != nil {
+		cols, rows = 80, 24
+	}
+	v.height = max(rows-1, 1)
+	v.top = min(v.top, len(v.lines)-v.height)
+	v.top = max(v.top, 0)
+	end := min(v.top+v.height, len(v.lines))
+
+	out := make([]string, 0, v.height+1)
+	for i := v.top; i < end; i++ {
+		from, to := v.selectedColumns(i)
+		cursor := -1
+		if i == v.cy {
+			cursor = v.cx
+		}
+		out = append(out, renderLine(v.lines[i], cols, from, to, cursor))
+	}
+	for len(out) < v.height {
+		out = append(out, "~")
+	}
+
+	var status string
+	switch {
+	case v.prompt != nil && v.searchBack:
+		status = "search up: " + *v.prompt
+	case v.prompt != nil:
+		status = "search down: " + *v.prompt
+	case v.message != "":
+		status = v.message
+	default:
+		hint := "v select, y copy, / search, q quit"
+		if v.emacs {
+			hint = "C-space mark, M-w copy, C-s search, q quit"
+		}
+		selecting := ""
+		if v.selecting {
+			selecting = " selecting,"
+		}
+		status = fmt.Sprintf("[copy]%s line %d of %d, %s", selecting, v.cy+1, len(v.lines), hint)
+	}
+	out = append(out, "\x1b[7m"+runewidth.Truncate(status, cols, "")+"\x1b[0m")
+	return v.a.showOverlay(modeScrollback, out)
+}
+
+// renderLine fits a line into cols cells and shows the runes in [from, to)
+// and the cursor in reverse video.
+func renderLine(line string, cols, from, to, cursor int) string {
+	runes := []rune(line)
+	n := max(len(runes), cursor+1)
+	var b strings.Builder
+	width, inverse := 0, false
+	for j := 0; j < n; j++ {
+		r := ' '
+		if j < len(runes) {
+			r = runes[j]
+		}
+		w := runewidth.RuneWidth(r)
+		if width+w > cols {
+			break
+		}
+		if hl := (j >= from && j < to) || j == cursor; hl != inverse {
+			if hl {
+				b.WriteString("\x1b[7m")
+			} else {
+				b.WriteString("\x1b[0m")
+			}
+			inverse = hl
+		}
+		b.WriteRune(r)
+		width += w
+	}
+	if inverse {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String()
+}
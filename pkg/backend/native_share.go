@@ -0,0 +1,126 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A native session can be shared with other local users. Its server then
+// also listens on a socket in the owner's shared directory, which everyone
+// can connect to; the server checks each connecting UID against the
+// session's ACL. Guests address the session as "owner/session".
+
+// Cred identifies the process on the other end of a unix socket.
+type Cred struct {
+	UID int
+	PID int
+}
+
+// ShareInfo describes a user a native session is shared with.
+type ShareInfo struct {
+	User     string `json:"user"`
+	UID      int    `json:"uid"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// sharedSocketRoot holds the shared socket directories. It is a fixed path
+// rather than os.TempDir, which differs between users on macOS.
+const sharedSocketRoot = "/tmp"
+
+// SharedSocketDir returns the directory holding the shared sockets of a
+// user's sessions. It is owned by that user and has mode 0711, so others
+// can reach a socket whose name they know but can neither list the
+// sessions nor plant sockets of their own.
+func SharedSocketDir(uid int) string {
+	return filepath.Join(sharedSocketRoot, fmt.Sprintf("txm-shared-%d", uid))
+}
+
+// SharedSocketPath returns the shared socket of one of the current user's
+// sessions, creating the shared directory if needed.
+func SharedSocketPath(name string) (string, error) {
+	dir := SharedSocketDir(os.Getuid())
+	if err := os.Mkdir(dir, 0711); err == nil {
+		// Undo the umask; guests need to traverse the directory.
+		if err := os.Chmod(dir, 0711); err != nil {
+			return "", err
+		}
+	} else if !os.IsExist(err) {
+		return "", fmt.Errorf("failed to create shared socket directory: %v", err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("shared socket directory %s is not a directory; refusing to use it", dir)
+	}
+	if err := checkShared(dir, info, os.Getuid()); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".sock"), nil
+}
+
+// AuditLogPath returns the file where session servers record what other
+// users do with shared sessions.
+func AuditLogPath() (string, error) {
+	dir, err := SocketDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "audit.log"), nil
+}
+
+// sharedSocket resolves "owner/session" to the socket of a session another
+// user shared, after checking that the directory really belongs to them.
+func sharedSocket(name string) (string, int, error) {
+	owner, session, _ := strings.Cut(name, "/")
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return "", 0, fmt.Errorf("unknown user %s", owner)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return "", 0, fmt.Errorf("user %s has no numeric uid", owner)
+	}
+
+	dir := SharedSocketDir(uid)
+	info, err := os.Lstat(dir)
+	if err != nil || !info.IsDir() {
+		return "", 0, fmt.Errorf("session %s does not exist or is not shared with you", name)
+	}
+	if err := checkShared(dir, info, uid); err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(dir, session+".sock")
+	if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSocket == 0 {
+		return "", 0, fmt.Errorf("session %s does not exist or is not shared with you", name)
+	}
+	return path, uid, nil
+}
+
+// ShareSession gives another local user read-only or read-write access to
+// a native session.
+func ShareSession(session, userName string, readOnly bool) error {
+	mode := "rw"
+	if readOnly {
+		mode = "ro"
+	}
+	return sessionCommand(session, nil, "share", userName, mode)
+}
+
+// UnshareSession revokes a user's access to a native session and
+// disconnects them.
+func UnshareSession(session, userName string) error {
+	return sessionCommand(session, nil, "unshare", userName)
+}
+
+// SessionShares lists the users a native session is shared with.
+func SessionShares(session string) ([]ShareInfo, error) {
+	var shares []ShareInfo
+	err := sessionCommand(session, &shares, "list-shares")
+	return shares, err
+}
@@ -0,0 +1,215 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SocketDir returns the private directory holding the current user's native
+// session sockets, creating it if needed: $XDG_RUNTIME_DIR/txm, or
+// txm-<uid> in the temporary directory when XDG_RUNTIME_DIR is unset. A
+// directory that is owned by another user or open to other users is
+// refused, since whoever controls it could impersonate our sessions.
+func SocketDir() (string, error) {
+	var dir string
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		dir = filepath.Join(runtimeDir, "txm")
+	} else {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("txm-%d", os.Getuid()))
+	}
+
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("failed to create socket directory: %v", err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to check socket directory: %v", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("socket directory %s is not a directory; refusing to use it", dir)
+	}
+	if err := checkPrivate(dir, info); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// SocketPath returns the path of the unix socket a native session server
+// listens on.
+func SocketPath(name string) (string, error) {
+	dir, err := SocketDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".sock"), nil
+}
+
+// legacySocketPath is where txm releases before the private socket
+// directory put the socket of a session.
+func legacySocketPath(name string) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("txm-%s.sock", name))
+}
+
+// findSocket returns the socket of an existing session. Sessions still
+// listening on the legacy path are found as long as the socket belongs to
+// the current user, and "owner/session" names the shared socket of another
+// user's session.
+func findSocket(name string) (string, error) {
+	if strings.Contains(name, "/") {
+		path, _, err := sharedSocket(name)
+		return path, err
+	}
+	path, err := SocketPath(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	legacy := legacySocketPath(name)
+	if info, err := os.Lstat(legacy); err == nil && ownedByCurrentUser(info) {
+		return legacy, nil
+	}
+	return "", fmt.Errorf("session %s does not exist", name)
+}
+
+// SessionInfo is stored next to a session's socket so that `txm gc` can
+// clean up after a server that died without removing its files.
+type SessionInfo struct {
+	PID     int    `json:"pid"`
+	LogFile string `json:"log_file,omitempty"`
+}
+
+// InfoPath returns the path of the SessionInfo file of a socket.
+func InfoPath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".json"
+}
+
+// sessionSocket is a socket found in the socket directory or on the legacy
+// path.
+type sessionSocket struct {
+	name   string
+	path   string
+	legacy bool
+	stale  bool
+}
+
+// listSockets finds the current user's session sockets and probes whether
+// a server still listens on each of them.
+func listSockets() ([]sessionSocket, error) {
+	dir, err := SocketDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.sock"))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var sockets []sessionSocket
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".sock")
+		seen[name] = true
+		sockets = append(sockets, sessionSocket{name: name, path: f, stale: socketStale(f)})
+	}
+
+	legacy, _ := filepath.Glob(filepath.Join(os.TempDir(), "txm-*.sock"))
+	for _, f := range legacy {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), "txm-"), ".sock")
+		if info, err := os.Lstat(f); err != nil || !ownedByCurrentUser(info) || seen[name] {
+			continue
+		}
+		sockets = append(sockets, sessionSocket{name: name, path: f, legacy: true, stale: socketStale(f)})
+	}
+	return sockets, nil
+}
+
+// socketStale reports whether nobody listens on a socket any more, which is
+// what a server that was killed or crashed leaves behind. Other connection
+// errors do not prove the server is gone.
+func socketStale(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, os.ErrNotExist)
+	}
+	_ = conn.Close()
+	return false
+}
+
+// logGenerationSuffix matches the suffix of rotated log files.
+var logGenerationSuffix = regexp.MustCompile(`^\.[0-9]+(\.gz)?$`)
+
+// logGenerations returns the rotated files of a session log: log.1,
+// log.2.gz and so on.
+func logGenerations(logFile string) []string {
+	entries, err := os.ReadDir(filepath.Dir(logFile))
+	if err != nil {
+		return nil
+	}
+	base := filepath.Base(logFile)
+	var paths []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, base) && logGenerationSuffix.MatchString(name[len(base):]) {
+			paths = append(paths, filepath.Join(filepath.Dir(logFile), name))
+		}
+	}
+	return paths
+}
+
+// CleanStaleSessions removes the sockets of native sessions whose server is
+// gone together with their info files and, unless keepLogs is set, the log
+// files recorded there. It returns the paths it removed, or would remove
+// when dryRun is set.
+func CleanStaleSessions(keepLogs, dryRun bool) ([]string, error) {
+	sockets, err := listSockets()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, s := range sockets {
+		if !s.stale {
+			continue
+		}
+		paths = append(paths, s.path)
+		info := InfoPath(s.path)
+		if _, err := os.Stat(info); err != nil {
+			continue
+		}
+		paths = append(paths, info)
+		if keepLogs {
+			continue
+		}
+		data, err := os.ReadFile(info)
+		var si SessionInfo
+		if err != nil || json.Unmarshal(data, &si) != nil || si.LogFile == "" {
+			continue
+		}
+		if _, err := os.Stat(si.LogFile); err == nil {
+			paths = append(paths, si.LogFile)
+		}
+		paths = append(paths, logGenerations(si.LogFile)...)
+	}
+
+	if dryRun {
+		return paths, nil
+	}
+	var removed []string
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, p)
+	}
+	return removed, nil
+}
@@ -0,0 +1,203 @@
+//go:build !windows
+
+package backend
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSocketDir(t *testing.T) {
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	dir, err := SocketDir()
+	if err != nil {
+		t.Fatalf("SocketDir: %v", err)
+	}
+	if want := filepath.Join(runtimeDir, "txm"); dir != want {
+		t.Errorf("SocketDir() = %q; want %q", dir, want)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("socket directory mode = %#o; want 0700", perm)
+	}
+
+	path, err := SocketPath("work")
+	if err != nil || path != filepath.Join(dir, "work.sock") {
+		t.Errorf("SocketPath(work) = %q, %v", path, err)
+	}
+
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SocketDir(); err == nil {
+		t.Error("expected SocketDir to refuse a directory open to other users")
+	}
+}
+
+func TestCleanStaleSessions(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	live, err := SocketPath("live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// A listener closed without unlinking its path is what a killed
+	// server leaves behind.
+	stale, _ := SocketPath("stale")
+	dead, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.(*net.UnixListener).SetUnlinkOnClose(false)
+	dead.Close()
+
+	logFile := filepath.Join(t.TempDir(), "stale.log")
+	info, _ := json.Marshal(SessionInfo{PID: 1, LogFile: logFile})
+	if err := os.WriteFile(InfoPath(stale), info, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{logFile, logFile + ".1", logFile + ".2.gz", logFile + ".bak"} {
+		if err := os.WriteFile(p, []byte("output"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := NewNativeBackend()
+	if !b.SessionExists("live") || b.SessionExists("stale") {
+		t.Errorf("SessionExists: live = %v, stale = %v", b.SessionExists("live"), b.SessionExists("stale"))
+	}
+	if sessions, _ := b.GetSessions(); len(sessions) != 1 || sessions[0] != "live" {
+		t.Errorf("GetSessions() = %q; want [live]", sessions)
+	}
+
+	removed, err := CleanStaleSessions(false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 5 {
+		t.Errorf("removed %q; want the stale socket, its info file and its log generations", removed)
+	}
+	for _, p := range []string{stale, InfoPath(stale), logFile, logFile + ".1", logFile + ".2.gz"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", p)
+		}
+	}
+	if _, err := os.Stat(live); err != nil {
+		t.Errorf("live socket was removed: %v", err)
+	}
+	if _, err := os.Stat(logFile + ".bak"); err != nil {
+		t.Errorf("unrelated file was removed: %v", err)
+	}
+}
+
+func TestSharedSocket(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	me, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	path, err := SharedSocketPath("pair")
+	if err != nil {
+		t.Fatalf("SharedSocketPath: %v", err)
+	}
+	info, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0711 {
+		t.Errorf("shared directory mode = %#o; want 0711", perm)
+	}
+
+	if _, _, err := sharedSocket(me.Username + "/pair"); err == nil {
+		t.Error("expected a missing shared socket to be rejected")
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	got, uid, err := sharedSocket(me.Username + "/pair")
+	if err != nil || got != path || uid != os.Getuid() {
+		t.Errorf("sharedSocket = %q, %d, %v; want %q, %d", got, uid, err, path, os.Getuid())
+	}
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cred, err := PeerCred(conn)
+	if err != nil || cred.UID != os.Getuid() {
+		t.Errorf("PeerCred = %+v, %v; want uid %d", cred, err, os.Getuid())
+	}
+}
+
+func TestProxySession(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	path, err := SocketPath("remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		fs := NewFrameConn(conn)
+		if _, err := fs.ServerHello(); err == nil {
+			_ = fs.WriteFrame(MsgOutput, []byte("hello"))
+		}
+		_ = fs.Close()
+	}()
+
+	// The client speaks the protocol to the proxy's stdin and stdout.
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- ProxySession("remote", stdinR, stdoutW)
+		_ = stdoutW.Close()
+	}()
+
+	fc := NewFrameConn(struct {
+		io.Reader
+		io.WriteCloser
+	}{stdoutR, stdinW})
+	if _, err := fc.ClientHello(Hello{}); err != nil {
+		t.Fatalf("ClientHello through proxy: %v", err)
+	}
+	typ, payload, err := fc.ReadFrame()
+	if err != nil || typ != MsgOutput || string(payload) != "hello" {
+		t.Errorf("ReadFrame = 0x%02x %q, %v; want output \"hello\"", typ, payload, err)
+	}
+	_ = stdinW.Close()
+	if err := <-errs; err != nil {
+		t.Errorf("ProxySession: %v", err)
+	}
+}
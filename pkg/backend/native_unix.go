@@ -3,32 +3,104 @@
 package backend
 
 import (
-	"net"
+	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
 	"golang.org/x/term"
 )
 
+// checkPrivate verifies that a socket directory belongs to the current user
+// and is closed to everyone else.
+func checkPrivate(dir string, info os.FileInfo) error {
+	if uid, ok := fileOwner(info); ok && uid != os.Getuid() {
+		return fmt.Errorf("socket directory %s is owned by uid %d, not by you (uid %d); refusing to use it", dir, uid, os.Getuid())
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("socket directory %s has mode %#o and is accessible to other users; refusing to use it (run chmod 700 %s)", dir, perm, dir)
+	}
+	return nil
+}
+
+// checkShared verifies that a shared socket directory belongs to uid and
+// that nobody else can create or remove sockets in it.
+func checkShared(dir string, info os.FileInfo, uid int) error {
+	if owner, ok := fileOwner(info); !ok || owner != uid {
+		return fmt.Errorf("shared socket directory %s is not owned by uid %d; refusing to use it", dir, uid)
+	}
+	if perm := info.Mode().Perm(); perm&0022 != 0 {
+		return fmt.Errorf("shared socket directory %s has mode %#o and is writable by other users; refusing to use it", dir, perm)
+	}
+	return nil
+}
+
+func fileOwner(info os.FileInfo) (int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Uid), true
+}
+
+func ownedByCurrentUser(info os.FileInfo) bool {
+	uid, ok := fileOwner(info)
+	return ok && uid == os.Getuid()
+}
+
 func setSysProcAttr(cmd *exec.Cmd) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 }
 
-func watchWindowSize(fd int, conn net.Conn) {
+// watchWindowSize sends the terminal size to the server now and whenever it
+// changes, until the returned function is called.
+func watchWindowSize(fd int, fc *FrameConn) (stop func()) {
 	sigwinch := make(chan os.Signal, 1)
 	signal.Notify(sigwinch, syscall.SIGWINCH)
 	go func() {
 		for range sigwinch {
 			w, h, err := term.GetSize(fd)
 			if err == nil {
-				// Send resize packet: [0x02, w(hi), w(lo), h(hi), h(lo)]
-				resizePacket := []byte{0x02, byte(w >> 8), byte(w), byte(h >> 8), byte(h)}
-				_, _ = conn.Write(resizePacket)
+				_ = fc.WriteFrame(MsgResize, EncodeSize(uint16(w), uint16(h)))
 			}
 		}
 	}()
 	// Trigger initial resize
 	sigwinch <- syscall.SIGWINCH
+	return func() {
+		signal.Stop(sigwinch)
+		close(sigwinch)
+	}
+}
+
+// ttyName returns the path of the terminal f refers to, or "" when it is
+// not a terminal. Linux links the path under /proc; elsewhere the device
+// is looked up in /dev.
+func ttyName(f *os.File) string {
+	if !term.IsTerminal(int(f.Fd())) {
+		return ""
+	}
+	if path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", f.Fd())); err == nil {
+		return path
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	for _, pattern := range []string{"/dev/pts/*", "/dev/tty*"} {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			var dev syscall.Stat_t
+			if syscall.Stat(path, &dev) == nil && dev.Mode&syscall.S_IFMT == syscall.S_IFCHR && dev.Rdev == st.Rdev {
+				return path
+			}
+		}
+	}
+	return ""
 }
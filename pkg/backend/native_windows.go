@@ -3,20 +3,39 @@
 package backend
 
 import (
-	"net"
+	"os"
 	"os/exec"
 
 	"golang.org/x/term"
 )
 
+// checkPrivate is a no-op on Windows, where the temporary directory is
+// already private to the user.
+func checkPrivate(dir string, info os.FileInfo) error {
+	return nil
+}
+
+func checkShared(dir string, info os.FileInfo, uid int) error {
+	return nil
+}
+
+func ownedByCurrentUser(info os.FileInfo) bool {
+	return true
+}
+
 func setSysProcAttr(cmd *exec.Cmd) {
 	// Not implemented for windows
 }
 
-func watchWindowSize(fd int, conn net.Conn) {
+func watchWindowSize(fd int, fc *FrameConn) (stop func()) {
 	w, h, err := term.GetSize(fd)
 	if err == nil {
-		resizePacket := []byte{0x02, byte(w >> 8), byte(w), byte(h >> 8), byte(h)}
-		_, _ = conn.Write(resizePacket)
+		_ = fc.WriteFrame(MsgResize, EncodeSize(uint16(w), uint16(h)))
 	}
+	return func() {}
+}
+
+// ttyName is not supported on Windows.
+func ttyName(f *os.File) string {
+	return ""
 }
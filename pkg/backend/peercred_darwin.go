@@ -0,0 +1,35 @@
+package backend
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// PeerCred returns the credentials of the process on the other end of a
+// unix socket connection, as recorded by the kernel when it connected.
+func PeerCred(conn net.Conn) (Cred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return Cred{}, fmt.Errorf("peer credentials need a unix socket")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return Cred{}, err
+	}
+	var cred Cred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		xucred, err := unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+		if err != nil {
+			credErr = err
+			return
+		}
+		cred.UID = int(xucred.Uid)
+		cred.PID, _ = unix.GetsockoptInt(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+	}); err != nil {
+		return Cred{}, err
+	}
+	return cred, credErr
+}
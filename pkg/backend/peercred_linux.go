@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// PeerCred returns the credentials of the process on the other end of a
+// unix socket connection, as recorded by the kernel when it connected.
+func PeerCred(conn net.Conn) (Cred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return Cred{}, fmt.Errorf("peer credentials need a unix socket")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return Cred{}, err
+	}
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return Cred{}, err
+	}
+	if credErr != nil {
+		return Cred{}, credErr
+	}
+	return Cred{UID: int(cred.Uid), PID: int(cred.Pid)}, nil
+}
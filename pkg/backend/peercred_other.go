@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package backend
+
+import (
+	"fmt"
+	"net"
+)
+
+// PeerCred is not available on this platform.
+func PeerCred(conn net.Conn) (Cred, error) {
+	return Cred{}, fmt.Errorf("peer credentials are not supported on this platform")
+}
@@ -0,0 +1,336 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// The native session server and its clients exchange length-prefixed frames:
+// a one byte message type, a four byte big-endian payload length and the
+// payload itself. Every connection starts with a MsgHello exchange carrying
+// both sides' ProtocolVersion, so a client and a server from different txm
+// releases fail with a clear error instead of misparsing each other's bytes.
+
+// ProtocolVersion is bumped whenever the meaning of an existing frame changes.
+const ProtocolVersion = 3
+
+// MaxFrameSize bounds a single payload so a broken peer cannot make us
+// allocate arbitrary amounts of memory.
+const MaxFrameSize = 16 << 20
+
+// protocolMagic identifies txm peers in the hello payload.
+const protocolMagic = "txm"
+
+// Message types. Replies reuse the type of the request they answer.
+const (
+	MsgHello   byte = 0x10 // handshake, JSON encoded Hello
+	MsgError   byte = 0x11 // failure description, plain text
+	MsgAttach  byte = 0x12 // register the connection as an interactive client
+	MsgInput   byte = 0x13 // bytes to write to the active window's PTY
+	MsgOutput  byte = 0x14 // bytes from the PTY or a screen snapshot
+	MsgResize  byte = 0x15 // terminal size, see EncodeSize
+	MsgKill    byte = 0x16 // terminate every process of the session
+	MsgStatus  byte = 0x17 // status query, replied with a JSON SessionStatus
+	MsgDump    byte = 0x18 // screen dump query, replied with the VT snapshot
+	MsgCommand byte = 0x19 // control command, JSON Command answered by CommandResult
+	MsgDetach  byte = 0x1a // tells an attached client to detach, see DetachExited
+	MsgWatch   byte = 0x1b // watch a pane, JSON Watch answered by a stream of PaneState
+	MsgPing    byte = 0x1c // heartbeat, answered by MsgPong
+	MsgPong    byte = 0x1d // heartbeat reply
+)
+
+// DetachExited is the MsgDetach payload sent to attached clients when the
+// session ends, as opposed to a client being detached. DetachKicked tells a
+// client that another client forced it off, with txm kick or attach -d.
+const (
+	DetachExited = "exited"
+	DetachKicked = "kicked"
+)
+
+// The server pings attached clients every HeartbeatInterval. Either side
+// gives up on a peer that has answered before but stayed silent for
+// HeartbeatTimeout, which catches connections that broke without being
+// closed, such as an ssh link through a dropped network.
+const (
+	HeartbeatInterval = 5 * time.Second
+	HeartbeatTimeout  = 3 * HeartbeatInterval
+)
+
+// ErrLegacyServer is returned when the server does not answer the handshake,
+// which is what a server started by a pre-framing txm release does.
+var ErrLegacyServer = errors.New("session server did not answer the protocol handshake; it was probably started by an older txm release, restart the session to use it with this version")
+
+// Hello is the handshake payload sent by both sides of a connection.
+type Hello struct {
+	Magic   string `json:"magic"`
+	Version int    `json:"version"`
+
+	// ReadOnly asks the server to ignore input, resize and kill messages
+	// and state-changing commands from this connection.
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+// Attach is the JSON payload of MsgAttach. Clients from older releases send
+// an empty payload.
+type Attach struct {
+	TTY string `json:"tty,omitempty"` // terminal the client runs in
+
+	// DetachOthers asks the server to detach every other client first.
+	DetachOthers bool `json:"detach_others,omitempty"`
+
+	// Sync asks for synchronized rendering: instead of the session's
+	// output, the client gets the changes to the screen at a limited frame
+	// rate, which keeps a slow link responsive.
+	Sync bool `json:"sync,omitempty"`
+}
+
+// Command asks the session server to perform a control operation such as
+// creating or switching windows.
+type Command struct {
+	Name string   `json:"name"`
+	Args []string `json:"args,omitempty"`
+}
+
+// CommandResult answers a Command. Data holds the JSON encoded return value
+// of commands that produce one.
+type CommandResult struct {
+	Error string          `json:"error,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// SessionStatus describes a native session in reply to MsgStatus. PID,
+// Foreground and the size refer to the active pane of the active window.
+type SessionStatus struct {
+	Created    time.Time `json:"created"`
+	LastAttach time.Time `json:"last_attach"`
+	Command    []string  `json:"command"`
+	PID        int       `json:"pid"`
+	Foreground string    `json:"foreground,omitempty"`
+	Cols       uint16    `json:"cols"`
+	Rows       uint16    `json:"rows"`
+	Windows    int       `json:"windows"`
+	Clients    int       `json:"clients"`
+	ReadOnly   int       `json:"read_only"` // read-only clients among Clients
+	LogFile    string    `json:"log_file,omitempty"`
+	Recording  string    `json:"recording,omitempty"` // asciicast file being written
+
+	// Dead is set when every process of a remain-on-exit session has
+	// exited. ExitStatus describes how the active pane's process exited.
+	Dead       bool   `json:"dead,omitempty"`
+	ExitStatus string `json:"exit_status,omitempty"`
+}
+
+// Watch asks the server to stream the state of a pane. Empty fields mean
+// the active window and pane. The connection carries nothing else after it.
+type Watch struct {
+	Window string `json:"window,omitempty"`
+	Pane   string `json:"pane,omitempty"`
+}
+
+// PaneState is sent to a watching connection right away, after the pane
+// had output and once its process exits, after which the server hangs up.
+type PaneState struct {
+	Screen     string `json:"screen"` // visible lines as plain text
+	Exited     bool   `json:"exited,omitempty"`
+	ExitStatus string `json:"exit_status,omitempty"`
+}
+
+// ClientInfo describes a client attached to a native session. PID and UID
+// are those of the process connected to the socket, which is the proxy for
+// clients attached with --via.
+type ClientInfo struct {
+	ID       int       `json:"id"`
+	PID      int       `json:"pid,omitempty"`
+	UID      int       `json:"uid"`
+	TTY      string    `json:"tty,omitempty"`
+	Cols     uint16    `json:"cols"`
+	Rows     uint16    `json:"rows"`
+	ReadOnly bool      `json:"read_only,omitempty"`
+	Sync     bool      `json:"sync,omitempty"` // synchronized rendering
+	Attached time.Time `json:"attached"`
+}
+
+// WindowInfo describes a window of a native session.
+type WindowInfo struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+	Panes  int    `json:"panes"`
+	Cols   uint16 `json:"cols"`
+	Rows   uint16 `json:"rows"`
+}
+
+// PaneInfo describes a pane of a native session window.
+type PaneInfo struct {
+	ID      int    `json:"id"`
+	Active  bool   `json:"active"`
+	Command string `json:"command"`
+	PID     int    `json:"pid"`
+	Cols    uint16 `json:"cols"`
+	Rows    uint16 `json:"rows"`
+	Dead    bool   `json:"dead,omitempty"`
+}
+
+// FrameConn reads and writes protocol frames over a byte stream. Writes are
+// serialized so that several goroutines may send frames concurrently.
+type FrameConn struct {
+	rw  io.ReadWriteCloser
+	r   *bufio.Reader
+	wmu sync.Mutex
+}
+
+// NewFrameConn wraps a byte stream, usually a unix socket connection.
+func NewFrameConn(rw io.ReadWriteCloser) *FrameConn {
+	return &FrameConn{
+		rw: rw,
+		r:  bufio.NewReader(rw),
+	}
+}
+
+// WriteFrame sends a single frame.
+func (c *FrameConn) WriteFrame(typ byte, payload []byte) error {
+	if len(payload) > MaxFrameSize {
+		return fmt.Errorf("frame too large: %d bytes", len(payload))
+	}
+	buf := make([]byte, 5+len(payload))
+	buf[0] = typ
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(payload)))
+	copy(buf[5:], payload)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.rw.Write(buf)
+	return err
+}
+
+// ReadFrame blocks until a complete frame has been received.
+func (c *FrameConn) ReadFrame() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:5])
+	if size > MaxFrameSize {
+		return 0, nil, fmt.Errorf("frame too large: %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// SetWriteDeadline forwards to the underlying connection when it supports
+// deadlines and is a no-op otherwise.
+func (c *FrameConn) SetWriteDeadline(t time.Time) error {
+	if d, ok := c.rw.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return d.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// Close closes the underlying stream.
+func (c *FrameConn) Close() error {
+	return c.rw.Close()
+}
+
+// ClientHello performs the client side of the handshake and returns the
+// server's hello.
+func (c *FrameConn) ClientHello(h Hello) (Hello, error) {
+	h.Magic = protocolMagic
+	h.Version = ProtocolVersion
+	data, err := json.Marshal(h)
+	if err != nil {
+		return Hello{}, err
+	}
+	if err := c.WriteFrame(MsgHello, data); err != nil {
+		return Hello{}, err
+	}
+
+	typ, payload, err := c.ReadFrame()
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return Hello{}, ErrLegacyServer
+		}
+		return Hello{}, err
+	}
+	switch typ {
+	case MsgHello:
+	case MsgError:
+		return Hello{}, errors.New(string(payload))
+	default:
+		return Hello{}, fmt.Errorf("unexpected message 0x%02x during handshake", typ)
+	}
+
+	var server Hello
+	if err := json.Unmarshal(payload, &server); err != nil || server.Magic != protocolMagic {
+		return Hello{}, ErrLegacyServer
+	}
+	if server.Version != ProtocolVersion {
+		return Hello{}, versionMismatch(ProtocolVersion, server.Version)
+	}
+	return server, nil
+}
+
+// ServerHello performs the server side of the handshake and returns the
+// client's hello. Clients speaking another protocol version get a MsgError
+// frame; clients that predate framing get a plain text explanation, since
+// they copy everything the server sends straight to the terminal.
+func (c *FrameConn) ServerHello() (Hello, error) {
+	first, err := c.r.Peek(1)
+	if err != nil {
+		return Hello{}, err
+	}
+	if first[0] != MsgHello {
+		msg := "txm: this session was started by a newer txm release and uses a different protocol; upgrade txm to attach\r\n"
+		_, _ = io.WriteString(c.rw, msg)
+		return Hello{}, errors.New("client does not speak the framed protocol")
+	}
+
+	typ, payload, err := c.ReadFrame()
+	if err != nil {
+		return Hello{}, err
+	}
+	var client Hello
+	if typ != MsgHello || json.Unmarshal(payload, &client) != nil || client.Magic != protocolMagic {
+		_ = c.WriteFrame(MsgError, []byte("malformed handshake"))
+		return Hello{}, errors.New("malformed handshake")
+	}
+	if client.Version != ProtocolVersion {
+		err := versionMismatch(client.Version, ProtocolVersion)
+		_ = c.WriteFrame(MsgError, []byte(err.Error()))
+		return Hello{}, err
+	}
+
+	data, err := json.Marshal(Hello{Magic: protocolMagic, Version: ProtocolVersion})
+	if err != nil {
+		return Hello{}, err
+	}
+	return client, c.WriteFrame(MsgHello, data)
+}
+
+func versionMismatch(client, server int) error {
+	return fmt.Errorf("protocol version mismatch: client speaks v%d but the session server speaks v%d; restart the session or use the txm binary that started it", client, server)
+}
+
+// EncodeSize encodes a terminal size for MsgResize.
+func EncodeSize(cols, rows uint16) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint16(buf[0:2], cols)
+	binary.BigEndian.PutUint16(buf[2:4], rows)
+	return buf
+}
+
+// DecodeSize decodes a MsgResize payload.
+func DecodeSize(payload []byte) (cols, rows uint16, err error) {
+	if len(payload) < 4 {
+		return 0, 0, fmt.Errorf("short resize payload")
+	}
+	return binary.BigEndian.Uint16(payload[0:2]), binary.BigEndian.Uint16(payload[2:4]), nil
+}
@@ -0,0 +1,135 @@
+package backend
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	defer func() { _ = server.Close() }()
+
+	fc := NewFrameConn(client)
+	fs := NewFrameConn(server)
+
+	// Larger than the old 4096 byte read buffer, and followed by a resize
+	// that the unframed protocol would have merged into the same read.
+	paste := bytes.Repeat([]byte("x"), 10000)
+	go func() {
+		_ = fc.WriteFrame(MsgInput, paste)
+		_ = fc.WriteFrame(MsgResize, EncodeSize(120, 40))
+	}()
+
+	typ, payload, err := fs.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if typ != MsgInput || !bytes.Equal(payload, paste) {
+		t.Errorf("got type 0x%02x with %d bytes; want input with %d bytes", typ, len(payload), len(paste))
+	}
+
+	typ, payload, err = fs.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	cols, rows, err := DecodeSize(payload)
+	if typ != MsgResize || err != nil || cols != 120 || rows != 40 {
+		t.Errorf("got type 0x%02x size %dx%d (%v); want resize 120x40", typ, cols, rows, err)
+	}
+}
+
+func TestReadFrameRejectsOversizedPayload(t *testing.T) {
+	header := []byte{MsgOutput, 0xff, 0xff, 0xff, 0xff}
+	fc := NewFrameConn(nopCloser{bytes.NewReader(header)})
+	if _, _, err := fc.ReadFrame(); err == nil {
+		t.Fatal("expected an error for an oversized frame")
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	defer func() { _ = server.Close() }()
+
+	errs := make(chan error, 1)
+	hellos := make(chan Hello, 1)
+	go func() {
+		hello, err := NewFrameConn(server).ServerHello()
+		hellos <- hello
+		errs <- err
+	}()
+
+	if _, err := NewFrameConn(client).ClientHello(Hello{ReadOnly: true}); err != nil {
+		t.Fatalf("ClientHello: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("ServerHello: %v", err)
+	}
+	if hello := <-hellos; !hello.ReadOnly {
+		t.Error("server did not see the read-only request")
+	}
+}
+
+func TestHandshakeVersionMismatch(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	defer func() { _ = server.Close() }()
+
+	go func() {
+		fc := NewFrameConn(client)
+		_ = fc.WriteFrame(MsgHello, []byte(`{"magic":"txm","version":999}`))
+		_, _, _ = fc.ReadFrame()
+	}()
+
+	_, err := NewFrameConn(server).ServerHello()
+	if err == nil || !strings.Contains(err.Error(), "version mismatch") {
+		t.Fatalf("expected a version mismatch error, got %v", err)
+	}
+}
+
+func TestHandshakeLegacyClient(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	defer func() { _ = server.Close() }()
+
+	reply := make(chan string, 1)
+	go func() {
+		// Pre-framing attach request.
+		_, _ = client.Write([]byte{0x00})
+		buf := make([]byte, 256)
+		n, _ := client.Read(buf)
+		reply <- string(buf[:n])
+	}()
+
+	if _, err := NewFrameConn(server).ServerHello(); err == nil {
+		t.Fatal("expected the legacy client to be rejected")
+	}
+	if msg := <-reply; !strings.Contains(msg, "upgrade txm") {
+		t.Errorf("legacy client got %q; want a plain text explanation", msg)
+	}
+}
+
+func TestClientHelloLegacyServer(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+
+	go func() {
+		// A pre-framing server closes connections it does not understand.
+		buf := make([]byte, 256)
+		_, _ = server.Read(buf)
+		_ = server.Close()
+	}()
+
+	if _, err := NewFrameConn(client).ClientHello(Hello{}); err != ErrLegacyServer {
+		t.Fatalf("got %v; want ErrLegacyServer", err)
+	}
+}
+
+type nopCloser struct{ io.Reader }
+
+func (nopCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (nopCloser) Close() error                { return nil }
@@ -52,10 +52,30 @@ func (b *ScreenBackend) SessionExists(name string) bool {
 
 func (b *ScreenBackend) CreateSession(name string, command ...string) error {
 	args := []string{"-dmS", name}
+	spawn := SpawnOptionsFromEnv()
+	if spawn.Term != "" {
+		args = append(args, "-T", spawn.Term)
+	}
+	if spawn.Login {
+		// screen starts a shell whose name begins with a dash as a login
+		// shell.
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		args = append(args, "-s", "-"+shell)
+	}
 	if len(command) > 0 {
 		args = append(args, command...)
 	}
-	return b.runCommand(args...)
+
+	cmd := exec.Command("screen", args...)
+	preserveEnvironment(cmd)
+	spawn.apply(cmd)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
 }
 
 func (b *ScreenBackend) ListSessions() error {
@@ -93,7 +113,10 @@ func (b *ScreenBackend) AttachSession(name string) error {
 	return b.runCommand("-r", name)
 }
 
-func (b *ScreenBackend) DetachSession() error {
+func (b *ScreenBackend) DetachSession(session, client string) error {
+	if session != "" && client == "" {
+		return b.runCommand("-d", session)
+	}
 	return fmt.Errorf("screen detach must be done manually with Ctrl-A d")
 }
 
@@ -124,6 +147,14 @@ func (b *ScreenBackend) RenameSession(oldName, newName string) error {
 	return fmt.Errorf("screen does not support session renaming")
 }
 
+func (b *ScreenBackend) RespawnSession(name string) error {
+	return fmt.Errorf("screen does not support respawning sessions")
+}
+
+func (b *ScreenBackend) WaitSession(session string, opts WaitOptions) error {
+	return fmt.Errorf("screen does not support waiting for sessions")
+}
+
 func (b *ScreenBackend) NewWindow(session, name string) error {
 	return b.runCommand("-S", session, "-X", "screen", "-t", name)
 }
@@ -170,6 +201,43 @@ func (b *ScreenBackend) Exec(session, window, pane, command string) error {
 	return b.runCommand("-S", session, "-X", "stuff", command+"\r")
 }
 
+// SendKeys stuffs the keys into a window of the session. screen has no
+// panes, so pane is ignored.
+func (b *ScreenBackend) SendKeys(session, window, pane string, keys []Key) error {
+	var data []byte
+	for _, k := range keys {
+		data = append(data, k.Data...)
+	}
+	args := []string{"-S", session}
+	if window != "" {
+		args = append(args, "-p", window)
+	}
+	return b.runCommand(append(args, "-X", "stuff", screenEscape(data))...)
+}
+
+// screenEscape quotes data for the stuff command, which expands variables
+// and interprets backslash and caret escapes. Control characters are
+// written as octal escapes.
+func screenEscape(data []byte) string {
+	var sb strings.Builder
+	for _, c := range data {
+		switch {
+		case c == '\\' || c == '^' || c == '$' || c == '"' || c == '\'':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&sb, "\\%03o", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func (b *ScreenBackend) CapturePane(session, window, pane string) (string, error) {
+	return "", fmt.Errorf("screen does not support capturing panes")
+}
+
 func (b *ScreenBackend) NukeAllSessions() error {
 	cmd := exec.Command("screen", "-ls")
 	output, err := cmd.Output()
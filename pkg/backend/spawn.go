@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SpawnOptions control how the processes of a new session start. txm create
+// hands them to the backends in TXM_SPAWN, the way its other flags travel in
+// TXM_* variables.
+type SpawnOptions struct {
+	Dir   string   `json:"dir,omitempty"`   // working directory
+	Env   []string `json:"env,omitempty"`   // KEY=VALUE pairs added to the environment
+	Term  string   `json:"term,omitempty"`  // TERM for the session's processes
+	Login bool     `json:"login,omitempty"` // start shells as login shells
+	Cols  uint16   `json:"cols,omitempty"`  // initial size, zero for the default
+	Rows  uint16   `json:"rows,omitempty"`
+}
+
+// Setenv stores the options in TXM_SPAWN for the backend to pick up.
+func (o SpawnOptions) Setenv() error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return os.Setenv("TXM_SPAWN", string(data))
+}
+
+// SpawnOptionsFromEnv returns the options stored in TXM_SPAWN, or none.
+func SpawnOptionsFromEnv() SpawnOptions {
+	var o SpawnOptions
+	if data := os.Getenv("TXM_SPAWN"); data != "" {
+		_ = json.Unmarshal([]byte(data), &o)
+	}
+	return o
+}
+
+// Environ returns the variables the options add to a process environment,
+// TERM included. Appended to the environment they override earlier values.
+func (o SpawnOptions) Environ() []string {
+	env := o.Env
+	if o.Term != "" {
+		env = append(env[:len(env):len(env)], "TERM="+o.Term)
+	}
+	return env
+}
+
+// apply makes cmd, which starts the server of a new session, pass the
+// options on to the session's processes. It is the nearest equivalent for
+// backends without flags for them.
+func (o SpawnOptions) apply(cmd *exec.Cmd) {
+	cmd.Dir = o.Dir
+	var env []string
+	for _, kv := range cmd.Env {
+		if !strings.HasPrefix(kv, "TXM_SPAWN=") {
+			env = append(env, kv)
+		}
+	}
+	cmd.Env = append(env, o.Environ()...)
+}
+
+// ParseEnvFile reads KEY=VALUE lines in the style of a .env file. Blank
+// lines and lines starting with # are skipped, an "export " prefix is
+// allowed and values may be single or double quoted.
+func ParseEnvFile(r io.Reader) ([]string, error) {
+	var env []string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+		env = append(env, key+"="+value)
+	}
+	return env, scanner.Err()
+}
@@ -0,0 +1,29 @@
+package backend
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	file := `# database
+DB_HOST=localhost
+export DB_USER = admin
+GREETING="hello\tworld"
+PATTERN='$HOME/*'
+EMPTY=
+`
+	env, err := ParseEnvFile(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"DB_HOST=localhost", "DB_USER=admin", "GREETING=hello\tworld", "PATTERN=$HOME/*", "EMPTY="}
+	if !slices.Equal(env, want) {
+		t.Errorf("env = %q; want %q", env, want)
+	}
+
+	if _, err := ParseEnvFile(strings.NewReader("OK=1\nnot a variable\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("invalid line: err = %v; want an error for line 2", err)
+	}
+}
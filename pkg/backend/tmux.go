@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var commonTmuxPaths = []string{
@@ -54,12 +56,60 @@ func (b *TmuxBackend) SessionExists(name string) bool {
 
 func (b *TmuxBackend) CreateSession(name string, command ...string) error {
 	args := []string{"new-session", "-d", "-s", name}
-	if len(command) > 0 {
+	spawn := SpawnOptionsFromEnv()
+	if spawn.Dir != "" {
+		args = append(args, "-c", spawn.Dir)
+	}
+	for _, kv := range spawn.Env {
+		args = append(args, "-e", kv)
+	}
+	if spawn.Cols != 0 && spawn.Rows != 0 {
+		args = append(args, "-x", strconv.Itoa(int(spawn.Cols)), "-y", strconv.Itoa(int(spawn.Rows)))
+	}
+	if spawn.Term != "" {
+		// tmux sets TERM from default-terminal over -e, so the first
+		// window gets it through env and later ones from the option.
+		if len(command) == 0 {
+			command = []string{tmuxLoginShell}
+		}
+		if len(command) == 1 {
+			// A single command is a shell command line.
+			command = []string{"export TERM=" + shellQuote(spawn.Term) + "; " + command[0]}
+		} else {
+			command = append([]string{"env", "TERM=" + spawn.Term}, command...)
+		}
+	}
+	remain := os.Getenv("TXM_REMAIN_ON_EXIT") == "1"
+	if remain {
+		// remain-on-exit has to be on before the command can exit, so the
+		// session starts with a placeholder that the command replaces
+		// below.
+		args = append(args, "cat")
+	} else if len(command) > 0 {
+		args = append(args, command...)
+	}
+	if spawn.Term != "" {
+		args = append(args, ";", "set-option", "-t", name, "default-terminal", spawn.Term)
+	}
+	if remain {
+		// The hook keeps the windows created later; split panes share the
+		// option of their window. Needs tmux 3.0 or later.
+		if len(command) == 0 {
+			command = []string{tmuxLoginShell}
+		}
+		args = append(args,
+			";", "set-option", "-w", "-t", name, "remain-on-exit", "on",
+			";", "set-hook", "-t", name, "after-new-window", "set-option -w remain-on-exit on",
+			";", "respawn-pane", "-k", "-t", name)
 		args = append(args, command...)
 	}
 	return b.runCommand(args...)
 }
 
+// tmuxLoginShell starts the default shell the way tmux does when a window
+// has no command: as a login shell.
+const tmuxLoginShell = `exec "$SHELL" -l`
+
 func (b *TmuxBackend) ListSessions() error {
 	return b.runCommand("list-sessions")
 }
@@ -95,7 +145,13 @@ func (b *TmuxBackend) AttachSession(name string) error {
 	return b.runCommand("attach-session", "-t", name)
 }
 
-func (b *TmuxBackend) DetachSession() error {
+func (b *TmuxBackend) DetachSession(session, client string) error {
+	if client != "" {
+		return b.runCommand("detach-client", "-t", client)
+	}
+	if session != "" {
+		return b.runCommand("detach-client", "-s", session)
+	}
 	return b.runCommand("detach-client")
 }
 
@@ -107,6 +163,33 @@ func (b *TmuxBackend) RenameSession(oldName, newName string) error {
 	return b.runCommand("rename-session", "-t", oldName, newName)
 }
 
+// RespawnSession restarts the command of every dead pane in all windows of
+// a session created with remain-on-exit, like the native backend.
+func (b *TmuxBackend) RespawnSession(name string) error {
+	cmd := exec.Command("tmux", "list-panes", "-s", "-t", name, "-F", "#{pane_id} #{pane_dead}")
+	preserveEnvironment(cmd)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list the panes of %s: %v", name, err)
+	}
+	respawned := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		id, dead, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if dead != "1" {
+			continue
+		}
+		if err := b.runCommand("respawn-pane", "-t", id); err != nil {
+			return err
+		}
+		respawned++
+	}
+	if respawned == 0 {
+		return fmt.Errorf("no dead panes to respawn")
+	}
+	return nil
+}
+
 func (b *TmuxBackend) NewWindow(session, name string) error {
 	return b.runCommand("new-window", "-t", session, "-n", name)
 }
@@ -153,8 +236,83 @@ func (b *TmuxBackend) KillPane(session, window, pane string) error {
 
 func (b *TmuxBackend) Exec(session, window, pane, command string) error {
 	paneTarget := fmt.Sprintf("%s:%s.%s", session, window, pane)
-	// For execution, we pass the command and append an enter key
-	return b.runCommand("send-keys", "-t", paneTarget, command, "Enter")
+	// The command is sent literally so that words in it like Enter or C-c
+	// are not taken for keys.
+	return b.runCommand(tmuxSendKeysArgs(paneTarget, []Key{{Data: []byte(command)}, namedKeys["enter"]})...)
+}
+
+func (b *TmuxBackend) SendKeys(session, window, pane string, keys []Key) error {
+	return b.runCommand(tmuxSendKeysArgs(tmuxTarget(session, window, pane), keys)...)
+}
+
+// CapturePane returns the pane's history and screen with wrapped lines
+// joined.
+func (b *TmuxBackend) CapturePane(session, window, pane string) (string, error) {
+	out, err := exec.Command("tmux", "capture-pane", "-p", "-J", "-S", "-", "-t", tmuxTarget(session, window, pane)).Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// tmuxTarget addresses a pane; empty window and pane mean the active ones.
+func tmuxTarget(session, window, pane string) string {
+	target := session
+	if window != "" || pane != "" {
+		target += ":" + window
+	}
+	if pane != "" {
+		target += "." + pane
+	}
+	return target
+}
+
+// tmuxSendKeysArgs chains one send-keys command per key into a single tmux
+// invocation, sending literal text with -l. tmux splits commands at
+// arguments ending in a semicolon, so such text escapes it.
+func tmuxSendKeysArgs(target string, keys []Key) []string {
+	var args []string
+	for _, k := range keys {
+		if len(args) > 0 {
+			args = append(args, ";")
+		}
+		if k.Name != "" {
+			args = append(args, "send-keys", "-t", target, k.Name)
+			continue
+		}
+		text := string(k.Data)
+		if strings.HasSuffix(text, ";") {
+			text = text[:len(text)-1] + "\\;"
+		}
+		args = append(args, "send-keys", "-t", target, "-l", "--", text)
+	}
+	return args
+}
+
+// WaitSession polls the pane with capture-pane, since tmux cannot stream
+// it to us.
+func (b *TmuxBackend) WaitSession(session string, opts WaitOptions) error {
+	target := tmuxTarget(session, opts.Window, opts.Pane)
+	paneDead := func() (bool, error) {
+		out, err := exec.Command("tmux", "display-message", "-p", "-t", target, "#{pane_dead}").Output()
+		return strings.TrimSpace(string(out)) == "1", err
+	}
+	if _, err := paneDead(); err != nil {
+		return fmt.Errorf("pane %s does not exist", target)
+	}
+
+	return pollWait(opts, 250*time.Millisecond, func() (string, bool, error) {
+		// Once the pane is gone, so is its process.
+		dead, err := paneDead()
+		if err != nil {
+			return "", true, nil
+		}
+		out, err := exec.Command("tmux", "capture-pane", "-p", "-t", target).Output()
+		if err != nil {
+			return "", true, nil
+		}
+		return string(out), dead, nil
+	})
 }
 
 func (b *TmuxBackend) NukeAllSessions() error {
@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ErrWaitTimeout is returned by WaitSession when its timeout expires before
+// the condition is met.
+var ErrWaitTimeout = errors.New("timed out")
+
+// WaitOptions selects what WaitSession waits for in a pane: exactly one of
+// Match, Idle and Exit. Empty Window and Pane mean the active ones.
+type WaitOptions struct {
+	Window string
+	Pane   string
+
+	// Match waits until the visible screen matches, Idle until the screen
+	// has not changed for that long and Exit until the pane's process has
+	// exited.
+	Match *regexp.Regexp
+	Idle  time.Duration
+	Exit  bool
+
+	// Timeout bounds the wait; zero waits forever.
+	Timeout time.Duration
+}
+
+// waitCondition evaluates WaitOptions against successive observations of a
+// pane.
+type waitCondition struct {
+	opts    WaitOptions
+	screen  string
+	changed time.Time
+}
+
+// observe records the state of the pane at now and reports whether the wait
+// is over. It fails when the pane exited before a pattern appeared, which
+// can no longer happen.
+func (w *waitCondition) observe(screen string, exited bool, now time.Time) (bool, error) {
+	switch {
+	case w.opts.Exit:
+		return exited, nil
+	case w.opts.Match != nil:
+		if w.opts.Match.MatchString(screen) {
+			return true, nil
+		}
+		if exited {
+			return false, fmt.Errorf("the process exited before %q appeared", w.opts.Match)
+		}
+		return false, nil
+	default:
+		if w.changed.IsZero() || screen != w.screen {
+			w.screen, w.changed = screen, now
+		}
+		return exited || now.Sub(w.changed) >= w.opts.Idle, nil
+	}
+}
+
+// idleDeadline is when the screen becomes idle if nothing changes, or the
+// zero time when not waiting for idleness.
+func (w *waitCondition) idleDeadline() time.Time {
+	if w.opts.Exit || w.opts.Match != nil || w.changed.IsZero() {
+		return time.Time{}
+	}
+	return w.changed.Add(w.opts.Idle)
+}
+
+// pollWait waits by calling observe every interval, for backends that
+// cannot stream the state of a pane.
+func pollWait(opts WaitOptions, interval time.Duration, observe func() (screen string, exited bool, err error)) error {
+	cond := &waitCondition{opts: opts}
+	var deadline time.Time
+	if opts.Timeout > 0 {
+		deadline = time.Now().Add(opts.Timeout)
+	}
+	for {
+		screen, exited, err := observe()
+		if err != nil {
+			return err
+		}
+		if done, err := cond.observe(screen, exited, time.Now()); done || err != nil {
+			return err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return ErrWaitTimeout
+		}
+		time.Sleep(interval)
+	}
+}
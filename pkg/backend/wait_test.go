@@ -0,0 +1,50 @@
+package backend
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestWaitCondition(t *testing.T) {
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	match := &waitCondition{opts: WaitOptions{Match: regexp.MustCompile(`\$ $`)}}
+	if done, _ := match.observe("building...", false, at(0)); done {
+		t.Error("match finished before the pattern appeared")
+	}
+	if done, _ := match.observe("done\n$ ", false, at(10)); !done {
+		t.Error("match did not finish once the pattern appeared")
+	}
+	if _, err := match.observe("crashed", true, at(20)); err == nil {
+		t.Error("match kept waiting after the process exited")
+	}
+
+	idle := &waitCondition{opts: WaitOptions{Idle: time.Second}}
+	for _, step := range []struct {
+		screen string
+		ms     int
+		done   bool
+	}{
+		{"a", 0, false},
+		{"ab", 800, false},
+		{"ab", 1500, false},
+		{"ab", 1800, true},
+	} {
+		if done, _ := idle.observe(step.screen, false, at(step.ms)); done != step.done {
+			t.Errorf("idle at %dms = %v; want %v", step.ms, done, step.done)
+		}
+	}
+	if got := idle.idleDeadline(); !got.Equal(at(1800)) {
+		t.Errorf("idle deadline = %v; want 1.8s after the start", got.Sub(start))
+	}
+
+	err := pollWait(WaitOptions{Exit: true, Timeout: 20 * time.Millisecond}, time.Millisecond, func() (string, bool, error) {
+		return "", false, nil
+	})
+	if !errors.Is(err, ErrWaitTimeout) {
+		t.Errorf("pollWait = %v; want a timeout", err)
+	}
+}
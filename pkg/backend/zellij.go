@@ -86,6 +86,9 @@ func (b *ZellijBackend) CreateSession(name string, command ...string) error {
 
 	cmd := exec.Command("zellij", args...)
 	preserveEnvironment(cmd)
+	// The session's server inherits the directory and environment; zellij
+	// has no way to size a background session.
+	SpawnOptionsFromEnv().apply(cmd)
 
 	cmd.Stdout = nil
 	cmd.Stderr = nil
@@ -276,10 +279,46 @@ func (b *ZellijBackend) Exec(session, window, pane, command string) error {
 	return b.runCommandWithSession(session, "action", "write", "10") // 10 is newline
 }
 
-func (b *ZellijBackend) DetachSession() error {
+// SendKeys writes literal text with write-chars and named keys as raw
+// bytes with write.
+func (b *ZellijBackend) SendKeys(session, window, pane string, keys []Key) error {
+	if !b.SessionExists(session) {
+		return fmt.Errorf("session '%s' does not exist", session)
+	}
+	if err := b.focusPane(session, window, pane); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		args := []string{"action", "write-chars", string(k.Data)}
+		if k.Name != "" {
+			args = []string{"action", "write"}
+			for _, c := range k.Data {
+				args = append(args, strconv.Itoa(int(c)))
+			}
+		}
+		if err := b.runCommandWithSession(session, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *ZellijBackend) CapturePane(session, window, pane string) (string, error) {
+	return "", fmt.Errorf("capture operation not supported in zellij")
+}
+
+func (b *ZellijBackend) RespawnSession(name string) error {
+	return fmt.Errorf("respawn operation not supported in zellij")
+}
+
+func (b *ZellijBackend) DetachSession(session, client string) error {
 	return fmt.Errorf("detach operation not supported in zellij")
 }
 
+func (b *ZellijBackend) WaitSession(session string, opts WaitOptions) error {
+	return fmt.Errorf("wait operation not supported in zellij")
+}
+
 func (b *ZellijBackend) NukeAllSessions() error {
 	if err := b.runCommand("delete-all-sessions", "-y", "-f"); err == nil {
 		return nil
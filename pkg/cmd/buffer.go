@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+// bufferArgs parses the session name and optional buffer index shared by
+// the buffer subcommands.
+func bufferArgs(command string, args []string) (string, int, error) {
+	session := getSessionName(args[0])
+	if err := validateName(session); err != nil {
+		return "", 0, err
+	}
+	if err := requireNative(command); err != nil {
+		return "", 0, err
+	}
+	index := 0
+	if len(args) > 1 {
+		var err error
+		if index, err = strconv.Atoi(args[1]); err != nil || index < 0 {
+			return "", 0, fmt.Errorf("invalid buffer index '%s'", args[1])
+		}
+	}
+	return session, index, nil
+}
+
+var listBuffersCmd = &cobra.Command{
+	Use:               "list [session_name]",
+	Short:             "List the paste buffers of a native session",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		session, _, err := bufferArgs("buffer list", args)
+		if err != nil {
+			return err
+		}
+		buffers, err := backend.SessionBuffers(session)
+		if err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to list buffers of session '%s': %v", session, err))
+			return nil
+		}
+		if len(buffers) == 0 {
+			logInstance.Info(fmt.Sprintf("Session '%s' has no buffers", session))
+			return nil
+		}
+		for i, b := range buffers {
+			preview := strings.ReplaceAll(b, "\n", "\\n")
+			if r := []rune(preview); len(r) > 60 {
+				preview = string(r[:60]) + "..."
+			}
+			fmt.Printf("%d: %d bytes: %s\n", i, len(b), preview)
+		}
+		return nil
+	},
+}
+
+var showBufferCmd = &cobra.Command{
+	Use:               "show [session_name] [index]",
+	Short:             "Print a paste buffer of a native session, the most recent by default",
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		session, index, err := bufferArgs("buffer show", args)
+		if err != nil {
+			return err
+		}
+		buffers, err := backend.SessionBuffers(session)
+		if err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to read buffers of session '%s': %v", session, err))
+			return nil
+		}
+		if index >= len(buffers) {
+			return fmt.Errorf("session '%s' has no buffer %d", session, index)
+		}
+		fmt.Print(buffers[index])
+		return nil
+	},
+}
+
+var pasteBufferCmd = &cobra.Command{
+	Use:               "paste [session_name] [index]",
+	Short:             "Type a paste buffer into the active pane of a native session",
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		session, index, err := bufferArgs("buffer paste", args)
+		if err != nil {
+			return err
+		}
+		if err := backend.PasteBuffer(session, index); err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to paste into session '%s': %v", session, err))
+		}
+		return nil
+	},
+}
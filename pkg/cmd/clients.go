@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+var clientsCmd = &cobra.Command{
+	Use:               "clients [session_name]",
+	Short:             "List the clients attached to a native session",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := getSessionName(args[0])
+		if err := validateName(name); err != nil {
+			return err
+		}
+		if err := requireNative("clients"); err != nil {
+			return err
+		}
+
+		clients, err := backend.SessionClients(name)
+		if err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to list the clients of session '%s': %v", name, err))
+			return nil
+		}
+		if len(clients) == 0 {
+			logInstance.Info(fmt.Sprintf("No clients are attached to session '%s'", name))
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tPID\tUSER\tTTY\tSIZE\tMODE\tATTACHED")
+		for _, c := range clients {
+			pid, tty, size := "-", "-", "-"
+			if c.PID != 0 {
+				pid = strconv.Itoa(c.PID)
+			}
+			if c.TTY != "" {
+				tty = c.TTY
+			}
+			if c.Cols != 0 {
+				size = fmt.Sprintf("%dx%d", c.Cols, c.Rows)
+			}
+			owner := strconv.Itoa(c.UID)
+			if u, err := user.LookupId(owner); err == nil {
+				owner = u.Username
+			}
+			mode := "read-write"
+			if c.ReadOnly {
+				mode = "read-only"
+			}
+			if c.Sync {
+				mode += ", sync"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				c.ID, pid, owner, tty, size, mode, c.Attached.Local().Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+	},
+}
+
+var kickCmd = &cobra.Command{
+	Use:               "kick [session_name] [client]",
+	Short:             "Disconnect a client from a native session",
+	Long:              "Disconnect one client, identified by the ID txm clients shows. The client is told that another client detached it.",
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := getSessionName(args[0])
+		if err := validateName(name); err != nil {
+			return err
+		}
+		if err := requireNative("kick"); err != nil {
+			return err
+		}
+
+		if err := backend.KickClient(name, args[1]); err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to kick client %s of session '%s': %v", args[1], name, err))
+			return nil
+		}
+		logInstance.Info(fmt.Sprintf("Kicked client %s of session '%s'", args[1], name))
+		return nil
+	},
+}
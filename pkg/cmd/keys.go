@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+var sendKeysLiteral bool
+
+var sendKeysCmd = &cobra.Command{
+	Use:   "send-keys [session[:window[.pane]]] [key...]",
+	Short: "Send named keys and text to a pane",
+	Long: "Send keys to a pane without pressing Enter. Arguments naming a key, such as Enter, Escape, Up, F5, C-c or M-x, " +
+		"are sent as that key and anything else as literal text. Without a window and pane the active pane receives them.",
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		session, window, pane, err := parseTarget(args[0])
+		if err != nil {
+			return err
+		}
+
+		keys := backend.ParseKeys(args[1:], sendKeysLiteral)
+		if err := manager.Backend.SendKeys(session, window, pane, keys); err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to send keys to '%s': %v", args[0], err))
+			return nil
+		}
+		return nil
+	},
+}
+
+// parseTarget splits a session[:window[.pane]] target and applies the
+// session prefix.
+func parseTarget(target string) (session, window, pane string, err error) {
+	session, rest, _ := strings.Cut(target, ":")
+	window, pane, _ = strings.Cut(rest, ".")
+	session = getSessionName(session)
+	if err := validateName(session); err != nil {
+		return "", "", "", err
+	}
+	if window != "" {
+		if err := validateName(window); err != nil {
+			return "", "", "", err
+		}
+	}
+	return session, window, pane, nil
+}
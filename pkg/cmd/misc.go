@@ -7,8 +7,10 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"os/user"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/MohamedElashri/txm/docs"
@@ -40,6 +42,50 @@ var configSetCmd = &cobra.Command{
 				return fmt.Errorf("invalid backend: %s. Must be tmux, zellij, or screen", value)
 			}
 			cfg.DefaultBackend = backendType
+		} else if key == "prefix_key" || key == "prefix" {
+			if _, err := config.ParsePrefixKey(value); err != nil {
+				return err
+			}
+			cfg.PrefixKey = value
+		} else if key == "mode_keys" {
+			keys, err := config.ParseModeKeys(value)
+			if err != nil {
+				return err
+			}
+			cfg.ModeKeys = keys
+		} else if key == "log_generations" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid log_generations: %s (use a number >= 0)", value)
+			}
+			cfg.LogGenerations = n
+		} else if key == "log_compress" || key == "log_timestamps" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %s (use true or false)", key, value)
+			}
+			if key == "log_compress" {
+				cfg.LogCompress = b
+			} else {
+				cfg.LogTimestamps = b
+			}
+		} else if key == "log_format" {
+			format, err := config.ParseLogFormat(value)
+			if err != nil {
+				return err
+			}
+			cfg.LogFormat = format
+		} else if key == "size_policy" {
+			policy, err := config.ParseSizePolicy(value)
+			if err != nil {
+				return err
+			}
+			cfg.SizePolicy = policy
+		} else if key == "share_group" {
+			if _, err := user.LookupGroup(value); err != nil {
+				return fmt.Errorf("unknown group: %s", value)
+			}
+			cfg.ShareGroup = value
 		} else {
 			return fmt.Errorf("unknown configuration key: %s", key)
 		}
@@ -66,6 +112,22 @@ var configGetCmd = &cobra.Command{
 
 		if key == "backend" || key == "default_backend" {
 			fmt.Println(cfg.DefaultBackend)
+		} else if key == "prefix_key" || key == "prefix" {
+			fmt.Println(cfg.PrefixKey)
+		} else if key == "mode_keys" {
+			fmt.Println(cfg.ModeKeys)
+		} else if key == "log_generations" {
+			fmt.Println(cfg.LogGenerations)
+		} else if key == "log_compress" {
+			fmt.Println(cfg.LogCompress)
+		} else if key == "log_format" {
+			fmt.Println(cfg.LogFormat)
+		} else if key == "log_timestamps" {
+			fmt.Println(cfg.LogTimestamps)
+		} else if key == "size_policy" {
+			fmt.Println(cfg.SizePolicy)
+		} else if key == "share_group" {
+			fmt.Println(cfg.ShareGroup)
 		} else {
 			return fmt.Errorf("unknown configuration key: %s", key)
 		}
@@ -86,6 +148,14 @@ var configShowCmd = &cobra.Command{
 		fmt.Println("txm Configuration:")
 		fmt.Printf("  Default Backend: %s\n", cfg.DefaultBackend)
 		fmt.Printf("  Backend Order:   %v\n", cfg.BackendOrder)
+		fmt.Printf("  Prefix Key:      %s\n", cfg.PrefixKey)
+		fmt.Printf("  Mode Keys:       %s\n", cfg.ModeKeys)
+		fmt.Printf("  Log Format:      %s (timestamps: %t)\n", cfg.LogFormat, cfg.LogTimestamps)
+		fmt.Printf("  Log Rotation:    %d bytes, %d generations (compress: %t)\n", cfg.LogRotationSize, cfg.LogGenerations, cfg.LogCompress)
+		fmt.Printf("  Size Policy:     %s\n", cfg.SizePolicy)
+		if cfg.ShareGroup != "" {
+			fmt.Printf("  Share Group:     %s\n", cfg.ShareGroup)
+		}
 		return nil
 	},
 }
@@ -1,10 +1,19 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"time"
+
 	"github.com/spf13/cobra"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
 )
 
+var execWait bool
+var execTimeout time.Duration
+
 var listPanesCmd = &cobra.Command{
 	Use:   "list [session_name] [window_name]",
 	Short: "List panes in a window",
@@ -70,11 +79,26 @@ var execCmd = &cobra.Command{
 			return err
 		}
 
+		if execWait {
+			output, status, err := backend.ExecWait(manager.Backend, session, window, pane, command, execTimeout)
+			if errors.Is(err, backend.ErrWaitTimeout) {
+				logInstance.Error(fmt.Sprintf("Timed out after %v waiting for the command in pane '%s'", execTimeout, pane))
+				os.Exit(124)
+			}
+			if err != nil {
+				logInstance.Error(fmt.Sprintf("Failed to execute command in pane '%s': %v", pane, err))
+				os.Exit(1)
+			}
+			fmt.Print(output)
+			os.Exit(status)
+		}
+
 		if err := manager.Backend.Exec(session, window, pane, command); err != nil {
 			logInstance.Error(fmt.Sprintf("Failed to execute command in pane '%s': %v", pane, err))
 			return nil
 		}
-		logInstance.Info(fmt.Sprintf("Executed command in pane '%s'", pane))
+		// Without --wait nothing tells whether the command ran.
+		logInstance.Info(fmt.Sprintf("Sent command to pane '%s'", pane))
 		return nil
 	},
 }
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+var attachVia string
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy [session_name]",
+	Short: "Relay a native session over stdin and stdout, for attach --via",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// stdout carries the protocol, so errors may only go to stderr.
+		fail := func(err error) {
+			fmt.Fprintf(os.Stderr, "txm proxy: %v\n", err)
+			os.Exit(1)
+		}
+
+		name := args[0]
+		if !strings.Contains(name, "/") {
+			name = getSessionName(name)
+			if err := validateName(name); err != nil {
+				fail(err)
+			}
+		} else if _, _, err := parseSharedName(name); err != nil {
+			fail(err)
+		}
+		if err := backend.ProxySession(name, os.Stdin, os.Stdout); err != nil {
+			fail(err)
+		}
+	},
+}
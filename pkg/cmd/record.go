@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/MohamedElashri/txm/pkg/asciicast"
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+var createRecordFile string
+var playSpeed float64
+var playIdleTimeLimit float64
+
+var recordStartCmd = &cobra.Command{
+	Use:               "start [session_name] [file]",
+	Short:             "Record a native session to an asciicast v2 file",
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		session := getSessionName(args[0])
+		if err := validateName(session); err != nil {
+			return err
+		}
+		if err := requireNative("record"); err != nil {
+			return err
+		}
+		path, err := filepath.Abs(args[1])
+		if err != nil {
+			return err
+		}
+
+		if err := backend.RecordSession(session, path); err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to record session '%s': %v", session, err))
+			return nil
+		}
+		logInstance.Info(fmt.Sprintf("Recording session '%s' to %s", session, path))
+		return nil
+	},
+}
+
+var recordStopCmd = &cobra.Command{
+	Use:               "stop [session_name]",
+	Short:             "Stop recording a native session",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		session := getSessionName(args[0])
+		if err := validateName(session); err != nil {
+			return err
+		}
+		if err := requireNative("record"); err != nil {
+			return err
+		}
+
+		if err := backend.StopRecording(session); err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to stop recording session '%s': %v", session, err))
+			return nil
+		}
+		logInstance.Info(fmt.Sprintf("Stopped recording session '%s'", session))
+		return nil
+	},
+}
+
+var playCmd = &cobra.Command{
+	Use:   "play [file]",
+	Short: "Replay an asciicast recording",
+	Long:  "Replay an asciicast v2 recording in the terminal. Press space to pause and resume, . to step while paused, and q to quit.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		rec, err := asciicast.NewReader(f)
+		if err != nil {
+			return err
+		}
+
+		// Read single keys for the playback controls when we can.
+		var keys chan byte
+		fd := int(os.Stdin.Fd())
+		if term.IsTerminal(fd) {
+			oldState, err := term.MakeRaw(fd)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = term.Restore(fd, oldState) }()
+			keys = make(chan byte)
+			go func() {
+				buf := make([]byte, 64)
+				for {
+					n, err := os.Stdin.Read(buf)
+					for _, b := range buf[:n] {
+						keys <- b
+					}
+					if err != nil {
+						close(keys)
+						return
+					}
+				}
+			}()
+		}
+
+		return asciicast.Play(rec, os.Stdout, asciicast.PlayOptions{
+			Speed:         playSpeed,
+			IdleTimeLimit: playIdleTimeLimit,
+		}, keys)
+	},
+}
@@ -143,17 +143,59 @@ func init() {
 	rootCmd.AddCommand(createCmd)
 	createCmd.Flags().SetInterspersed(false)
 	createCmd.Flags().StringVarP(&createLogFile, "log", "l", "", "Log session output to a file")
+	createCmd.Flags().StringVar(&createLogFormat, "log-format", "", "Log raw PTY output or plain rendered text (raw, plain)")
+	createCmd.Flags().BoolVar(&createLogTimestamps, "log-timestamps", false, "Prefix every log line with a timestamp")
+	createCmd.Flags().StringVar(&createRecordFile, "record", "", "Record the session to an asciicast v2 file (native backend)")
+	createCmd.Flags().BoolVar(&createRemainOnExit, "remain-on-exit", false, "Keep the session and its final screen after the command exits")
+	createCmd.Flags().StringVar(&createCwd, "cwd", "", "Start the session's processes in a directory")
+	createCmd.Flags().StringArrayVar(&createEnv, "env", nil, "Set an environment variable KEY=VALUE (repeatable)")
+	createCmd.Flags().StringVar(&createEnvFile, "env-file", "", "Set environment variables from a .env file")
+	createCmd.Flags().StringVar(&createTerm, "term", "", "Set TERM for the session's processes")
+	createCmd.Flags().BoolVar(&createLogin, "login", false, "Start shells as login shells")
+	createCmd.Flags().StringVar(&createSize, "size", "", "Initial size COLSxROWS until a client attaches")
+	createCmd.Flags().StringVar(&createSizePolicy, "size-policy", "", "Size the session for several clients: smallest, largest, latest or COLSxROWS (native backend)")
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(attachCmd)
 	attachCmd.Flags().SetInterspersed(false)
 	attachCmd.Flags().BoolVarP(&attachReadOnly, "read-only", "r", false, "Attach in read-only mode")
+	attachCmd.Flags().BoolVar(&attachReconnect, "reconnect", false, "Reconnect when the connection to a native session is lost")
+	attachCmd.Flags().BoolVarP(&attachDetachOthers, "detach-others", "d", false, "Detach every other client of a native session first")
+	attachCmd.Flags().BoolVar(&attachSync, "sync", false, "Receive rate-limited screen updates instead of raw output, for slow links (native backend)")
+	attachCmd.Flags().StringVar(&attachVia, "via", "", "Reach a native session through a command running txm proxy, e.g. \"ssh host txm proxy\"")
 	rootCmd.AddCommand(detachCmd)
+	rootCmd.AddCommand(clientsCmd)
+	rootCmd.AddCommand(kickCmd)
 	rootCmd.AddCommand(deleteCmd)
 	rootCmd.AddCommand(renameSessionCmd)
+	rootCmd.AddCommand(respawnCmd)
+	rootCmd.AddCommand(sizePolicyCmd)
 	rootCmd.AddCommand(nukeCmd)
+	rootCmd.AddCommand(playCmd)
+	playCmd.Flags().Float64VarP(&playSpeed, "speed", "s", 1, "Playback speed multiplier")
+	playCmd.Flags().Float64VarP(&playIdleTimeLimit, "idle-time-limit", "i", 0, "Cap pauses between events at this many seconds")
+	rootCmd.AddCommand(proxyCmd)
+	rootCmd.AddCommand(shareCmd)
+	shareCmd.Flags().StringVarP(&shareUser, "user", "u", "", "User to share the session with")
+	shareCmd.Flags().BoolVar(&shareReadOnly, "read-only", false, "Only let the user watch (default)")
+	shareCmd.Flags().BoolVar(&shareReadWrite, "read-write", false, "Let the user type into the session")
+	rootCmd.AddCommand(unshareCmd)
+	unshareCmd.Flags().StringVarP(&shareUser, "user", "u", "", "User to revoke access from")
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().BoolVarP(&gcDryRun, "dry-run", "n", false, "Only print what would be removed")
+	gcCmd.Flags().BoolVar(&gcKeepLogs, "keep-logs", false, "Keep the log files of dead sessions")
 	rootCmd.AddCommand(serverCmd)
 	serverCmd.Flags().SetInterspersed(false)
 	rootCmd.AddCommand(execCmd)
+	execCmd.Flags().BoolVarP(&execWait, "wait", "w", false, "Wait for the command, print its output and exit with its status")
+	execCmd.Flags().DurationVarP(&execTimeout, "timeout", "t", 0, "Give up waiting after this long, e.g. 30s (default: wait forever)")
+	rootCmd.AddCommand(sendKeysCmd)
+	sendKeysCmd.Flags().SetInterspersed(false)
+	sendKeysCmd.Flags().BoolVarP(&sendKeysLiteral, "literal", "l", false, "Send every argument as literal text")
+	rootCmd.AddCommand(waitCmd)
+	waitCmd.Flags().StringVarP(&waitMatch, "match", "m", "", "Wait until the screen matches this regular expression")
+	waitCmd.Flags().DurationVar(&waitIdle, "idle", 0, "Wait until the screen has not changed for this long, e.g. 2s")
+	waitCmd.Flags().BoolVar(&waitExit, "exit", false, "Wait until the process in the pane exits")
+	waitCmd.Flags().DurationVarP(&waitTimeout, "timeout", "t", 0, "Give up after this long, e.g. 30s (default: wait forever)")
 	rootCmd.AddCommand(dumpCmd)
 	rootCmd.AddCommand(generateSshConfigCmd)
 
@@ -180,6 +222,25 @@ func init() {
 	paneCmd.AddCommand(listPanesCmd)
 	paneCmd.AddCommand(killPaneCmd)
 
+	// Recording
+	var recordCmd = &cobra.Command{
+		Use:   "record",
+		Short: "Record native sessions to asciicast files",
+	}
+	rootCmd.AddCommand(recordCmd)
+	recordCmd.AddCommand(recordStartCmd)
+	recordCmd.AddCommand(recordStopCmd)
+
+	// Paste Buffers
+	var bufferCmd = &cobra.Command{
+		Use:   "buffer",
+		Short: "Manage the paste buffers of a native session",
+	}
+	rootCmd.AddCommand(bufferCmd)
+	bufferCmd.AddCommand(listBuffersCmd)
+	bufferCmd.AddCommand(showBufferCmd)
+	bufferCmd.AddCommand(pasteBufferCmd)
+
 	// Misc
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(configSetCmd)
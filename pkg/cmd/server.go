@@ -1,17 +1,23 @@
 package cmd
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/creack/pty"
 	"github.com/spf13/cobra"
-	"go.mitchellh.com/libghostty"
+
+	"github.com/MohamedElashri/txm/pkg/asciicast"
+	"github.com/MohamedElashri/txm/pkg/backend"
+	"github.com/MohamedElashri/txm/pkg/config"
 )
 
 var serverCmd = &cobra.Command{
@@ -22,278 +28,603 @@ var serverCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		mgr, _ := getManager()
 		scrollbackSize := 65536
-		logRotationSize := 10485760
+		logOpts := logOptions{maxSize: 10485760, generations: 1}
+		logFormat := "raw"
+		sizePolicy := "latest"
+		shareGroup := ""
 		if mgr != nil && mgr.Config != nil {
 			if mgr.Config.ScrollbackSize > 0 {
 				scrollbackSize = mgr.Config.ScrollbackSize
 			}
 			if mgr.Config.LogRotationSize > 0 {
-				logRotationSize = mgr.Config.LogRotationSize
+				logOpts.maxSize = mgr.Config.LogRotationSize
 			}
+			logOpts.generations = mgr.Config.LogGenerations
+			logOpts.compress = mgr.Config.LogCompress
+			logOpts.timestamps = mgr.Config.LogTimestamps
+			logFormat = mgr.Config.LogFormat
+			sizePolicy = mgr.Config.SizePolicy
+			shareGroup = mgr.Config.ShareGroup
+		}
+		// Options given to txm create override the config file.
+		if format := os.Getenv("TXM_LOG_FORMAT"); format != "" {
+			logFormat = format
+		}
+		if os.Getenv("TXM_LOG_TIMESTAMPS") == "1" {
+			logOpts.timestamps = true
+		}
+		if policy := os.Getenv("TXM_SIZE_POLICY"); policy != "" {
+			sizePolicy = policy
 		}
 
-		term, err := libghostty.NewTerminal(
-			libghostty.WithSize(80, 24),
-			libghostty.WithMaxScrollback(uint(scrollbackSize)),
-		)
-		if err != nil {
-			return fmt.Errorf("failed to create libghostty terminal: %v", err)
+		srv := &nativeServer{
+			name:           args[0],
+			argv:           args[1:],
+			scrollbackSize: scrollbackSize,
+			remainOnExit:   os.Getenv("TXM_REMAIN_ON_EXIT") == "1",
+			sizePolicy:     sizePolicy,
+			shareGroup:     shareGroup,
+			spawn:          backend.SpawnOptionsFromEnv(),
+			cols:           80,
+			rows:           24,
+		}
+		if srv.spawn.Cols != 0 && srv.spawn.Rows != 0 {
+			srv.cols, srv.rows = srv.spawn.Cols, srv.spawn.Rows
+		}
+		if cols, rows, ok := config.FixedSize(sizePolicy); ok {
+			srv.cols, srv.rows = cols, rows
 		}
-		defer term.Close()
 
 		logFile := os.Getenv("TXM_LOG_FILE")
-		var logWriter *rotatingFileWriter
 		if logFile != "" {
-			var err error
-			logWriter, err = newRotatingFileWriter(logFile, logRotationSize)
+			logWriter, err := newRotatingFileWriter(logFile, logOpts)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: failed to open log file: %v\n", err)
 			} else {
+				srv.logWriter = logWriter
+				srv.logFile, _ = filepath.Abs(logFile)
+				srv.plainLog = logFormat == "plain"
 				defer func() { _ = logWriter.Close() }()
 			}
 		}
 
-		session := args[0]
-		socketPath := filepath.Join(os.TempDir(), fmt.Sprintf("txm-%s.sock", session))
+		return srv.run()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serverCmd)
+	serverCmd.Flags().SetInterspersed(false)
+}
 
-		_ = os.Remove(socketPath)
+// nativeServer is the background process behind a native session. It owns
+// the session's windows and relays their output to attached clients.
+type nativeServer struct {
+	id             string
+	name           string
+	argv           []string
+	scrollbackSize int
+	remainOnExit   bool
+	logWriter      *rotatingFileWriter
+	logFile        string
+	plainLog       bool       // log rendered lines instead of raw output
+	logMu          sync.Mutex // serializes plain logging, guards the panes' log state
+	listener       net.Listener
+	created        time.Time
+	command        []string // command line of the first window
+	spawn          backend.SpawnOptions
 
-		listener, err := net.Listen("unix", socketPath)
-		if err != nil {
-			return err
+	// mu guards everything below. It is held while output is written to
+	// clients so that a window switch cannot interleave with a broadcast.
+	mu            sync.Mutex
+	socketPath    string
+	windows       []*serverWindow
+	active        int
+	nextWindowID  int
+	clients       []*serverClient
+	writers       sync.WaitGroup // the clients' writeLoops
+	nextClientID  int
+	lastClient    *serverClient
+	lastAttach    time.Time
+	cols, rows    uint16
+	renderPending bool
+	screens       int      // counts the screens sent to all clients, see render
+	outputs       int      // counts the output written to the panes, see resyncClient
+	buffers       []string // paste buffers, most recent first
+
+	// sizePolicy decides cols and rows from the sizes of the clients, see
+	// applySizeLocked. sizeClient is the client that resized last.
+	sizePolicy string
+	sizeClient *serverClient
+
+	// recorder writes what clients see to recordPath while a recording
+	// runs.
+	recorder   *asciicast.Writer
+	recordPath string
+
+	// acl maps the UIDs the session is shared with to whether their access
+	// is read-only. Guests connect through sharedListener at sharedPath,
+	// which only the owner and shareGroup may connect to.
+	acl            map[int]bool
+	sharedListener net.Listener
+	sharedPath     string
+	shareGroup     string
+}
+
+func (s *nativeServer) run() error {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	s.id = hex.EncodeToString(id)
+	s.created = time.Now()
+
+	socketPath, err := backend.SocketPath(s.name)
+	if err != nil {
+		return err
+	}
+
+	_ = os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	// The socket may be renamed while we run, so remove whatever path it
+	// has at exit ourselves instead of letting Close unlink the original.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		_ = listener.Close()
+		_ = os.Remove(socketPath)
+		return err
+	}
+	defer func() { _ = listener.Close() }()
+	defer func() {
+		s.mu.Lock()
+		_ = os.Remove(s.socketPath)
+		_ = os.Remove(backend.InfoPath(s.socketPath))
+		if s.sharedListener != nil {
+			_ = s.sharedListener.Close()
+			_ = os.Remove(s.sharedPath)
 		}
-		
-		if err := os.Chmod(socketPath, 0600); err != nil {
-			_ = listener.Close()
-			return err
+		if s.recorder != nil {
+			_ = s.stopRecordingLocked()
 		}
-		defer func() { _ = listener.Close() }()
-		defer func() { _ = os.Remove(socketPath) }()
+		s.mu.Unlock()
+	}()
+	s.listener = listener
+	s.socketPath = socketPath
 
-		shell := os.Getenv("SHELL")
-		if shell == "" {
-			shell = "bash"
-		}
-		
-		var shellCmd *exec.Cmd
-		if len(args) > 1 {
-			shellCmd = exec.Command(args[1], args[2:]...)
-		} else {
-			shellCmd = exec.Command(shell)
+	info, err := json.Marshal(backend.SessionInfo{PID: os.Getpid(), LogFile: s.logFile})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(backend.InfoPath(socketPath), info, 0600); err != nil {
+		return err
+	}
+
+	w, err := s.newWindow("", s.argv)
+	if err != nil {
+		return err
+	}
+	s.command = w.activePane.cmd.Args
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.heartbeatLoop(stop)
+	if s.plainLog {
+		go s.plainLogLoop(stop)
+	}
+
+	if path := os.Getenv("TXM_RECORD_FILE"); path != "" {
+		if err := s.startRecording(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 		}
-		shellCmd.Env = os.Environ()
+	}
 
-		ptmx, err := pty.Start(shellCmd)
+	for {
+		conn, err := listener.Accept()
 		if err != nil {
-			return err
+			break
 		}
-		defer func() { _ = ptmx.Close() }()
-
-		var connsMutex sync.Mutex
-		var conns []net.Conn
-		var termMutex sync.Mutex
-
-		go func() {
-			buf := make([]byte, 4096)
-			for {
-				n, err := ptmx.Read(buf)
-				if err != nil {
-					break
-				}
-				
-				termMutex.Lock()
-				_, _ = term.Write(buf[:n])
-				termMutex.Unlock()
-				
-				if logWriter != nil {
-					_, _ = logWriter.Write(buf[:n])
-				}
-
-				connsMutex.Lock()
-				for _, c := range conns {
-					_ = c.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
-					if _, err := c.Write(buf[:n]); err != nil {
-						_ = c.Close()
-					}
-				}
-				connsMutex.Unlock()
-			}
-			_ = listener.Close()
-		}()
-
-		for {
-			conn, err := listener.Accept()
-			if err != nil {
-				break
-			}
-
-			go func(c net.Conn) {
-				buf := make([]byte, 4096)
-				n, err := c.Read(buf)
-				if err != nil || n == 0 {
-					_ = c.Close()
-					return
-				}
-
-				if buf[0] == 0x04 {
-					connsMutex.Lock()
-					count := len(conns)
-					connsMutex.Unlock()
-					_, _ = c.Write([]byte{byte(count)})
-					_ = c.Close()
-					return
-				} else if buf[0] == 0x05 {
-					termMutex.Lock()
-					f, err := libghostty.NewFormatter(term, libghostty.WithFormatterFormat(libghostty.FormatterFormatVT))
-					var output string
-					if err == nil {
-						output, _ = f.FormatString()
-						f.Close()
-					}
-					termMutex.Unlock()
-					if err == nil {
-						_, _ = c.Write([]byte(output))
-					}
-					_ = c.Close()
-					return
-				} else if buf[0] == 0x00 {
-					termMutex.Lock()
-					f, err := libghostty.NewFormatter(term, libghostty.WithFormatterFormat(libghostty.FormatterFormatVT))
-					var output string
-					if err == nil {
-						output, _ = f.FormatString()
-						f.Close()
-					}
-					termMutex.Unlock()
-					
-					if err == nil {
-						_, _ = c.Write([]byte(output))
-					}
-					
-					connsMutex.Lock()
-					conns = append(conns, c)
-					connsMutex.Unlock()
-
-					defer func() {
-						_ = c.Close()
-						connsMutex.Lock()
-						for i, existing := range conns {
-							if existing == c {
-								conns = append(conns[:i], conns[i+1:]...)
-								break
-							}
-						}
-						connsMutex.Unlock()
-					}()
-
-					processPacket := func(data []byte) {
-						if data[0] == 0x01 {
-							_, _ = ptmx.Write(data[1:])
-						} else if data[0] == 0x02 && len(data) >= 5 {
-							w := (uint16(data[1]) << 8) | uint16(data[2])
-							h := (uint16(data[3]) << 8) | uint16(data[4])
-							_ = pty.Setsize(ptmx, &pty.Winsize{
-								Rows: uint16(h),
-								Cols: uint16(w),
-							})
-							
-							termMutex.Lock()
-							_ = term.Resize(w, h, 0, 0)
-							termMutex.Unlock()
-						} else if data[0] == 0x03 {
-							_ = shellCmd.Process.Kill()
-						}
-					}
-
-					if n > 1 {
-						processPacket(buf[1:n])
-					}
-
-					for {
-						n, err := c.Read(buf)
-						if err != nil {
-							break
-						}
-						if n > 0 {
-							processPacket(buf[:n])
-						}
-					}
-				} else {
-					_ = c.Close()
-				}
-			}(conn)
+		p := peer{uid: os.Getuid()}
+		if cred, err := backend.PeerCred(conn); err == nil {
+			p.pid = cred.PID
 		}
+		go s.handleConn(backend.NewFrameConn(conn), p)
+	}
+
+	// Give the clients' writers a moment to deliver the final detach.
+	flushed := make(chan struct{})
+	go func() {
+		s.writers.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+	}
+	return nil
+}
 
-		_ = shellCmd.Wait()
+// activeWindowLocked returns the window clients are looking at. s.mu must be held.
+func (s *nativeServer) activeWindowLocked() *serverWindow {
+	if len(s.windows) == 0 {
 		return nil
-	},
+	}
+	return s.windows[s.active]
 }
 
-func init() {
-	rootCmd.AddCommand(serverCmd)
-	serverCmd.Flags().SetInterspersed(false)
+func (s *nativeServer) activeWindow() *serverWindow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeWindowLocked()
+}
+
+// broadcastLocked queues output for every attached client. Clients whose
+// terminal differs from the session size get a rendered frame instead, see
+// scheduleRenderLocked. s.mu must be held.
+func (s *nativeServer) broadcastLocked(data []byte) {
+	if s.recorder != nil {
+		_ = s.recorder.Output(data)
+	}
+	// The queues outlive the PTY reader's buffer.
+	data = bytes.Clone(data)
+	for _, c := range s.clients {
+		if c.framed {
+			s.scheduleRenderLocked()
+			continue
+		}
+		s.sendLocked(c, data)
+	}
 }
 
-type rotatingFileWriter struct {
-	filename string
-	maxSize  int
-	file     *os.File
-	size     int
-	mu       sync.Mutex
+// sendLocked queues output for one client. s.mu must be held.
+func (s *nativeServer) sendLocked(c *serverClient, data []byte) {
+	s.enqueueLocked(c, backend.MsgOutput, data)
 }
 
-func newRotatingFileWriter(filename string, maxSize int) (*rotatingFileWriter, error) {
-	if filename == "" {
-		return nil, nil
+// redrawLocked replaces every client's screen with the active window, used
+// after the active window or its layout changes. s.mu must be held.
+func (s *nativeServer) redrawLocked() {
+	w := s.activeWindowLocked()
+	if w == nil {
+		return
+	}
+	s.screens++
+	if len(w.panes) > 1 {
+		// Composited frames replace the whole screen.
+		s.scheduleRenderLocked()
+		return
+	}
+	output, err := s.screenLocked(w)
+	if err != nil {
+		return
 	}
-	var size int
-	info, err := os.Stat(filename)
-	if err == nil {
-		size = int(info.Size())
+	s.broadcastLocked([]byte("\x1b[H\x1b[2J" + output))
+}
+
+// screenLocked renders what clients should see for a window: the VT
+// snapshot of its only pane, or the composited frame of all its panes.
+// s.mu must be held.
+func (s *nativeServer) screenLocked(w *serverWindow) (string, error) {
+	if len(w.panes) == 1 {
+		return w.panes[0].snapshot()
 	}
+	return s.composeLocked(w, s.cols, s.rows), nil
+}
+
+// handleConn serves one connection. Guests are limited by their ACL entry
+// on top of what they asked for in the handshake.
+func (s *nativeServer) handleConn(c *backend.FrameConn, p peer) {
+	defer func() { _ = c.Close() }()
 
-	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	hello, err := c.ServerHello()
 	if err != nil {
-		return nil, err
+		return
+	}
+	readOnly := hello.ReadOnly || p.readOnly
+
+	var client *serverClient
+	defer func() {
+		if client != nil {
+			s.removeClient(client)
+		}
+	}()
+
+	for {
+		typ, payload, err := c.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		switch typ {
+		case backend.MsgStatus:
+			reply, _ := json.Marshal(s.status())
+			_ = c.WriteFrame(backend.MsgStatus, reply)
+		case backend.MsgDump:
+			output := ""
+			s.mu.Lock()
+			if client != nil && client.framed {
+				output = s.clientScreenLocked(client)
+			} else if w := s.activeWindowLocked(); w != nil {
+				output, err = s.screenLocked(w)
+			}
+			if client != nil && err == nil {
+				// Queued like output, so that older output cannot land on
+				// top of the redrawn screen.
+				s.enqueueLocked(client, backend.MsgDump, []byte(output))
+				s.mu.Unlock()
+				continue
+			}
+			s.mu.Unlock()
+			if err != nil {
+				_ = c.WriteFrame(backend.MsgError, []byte(err.Error()))
+			} else {
+				_ = c.WriteFrame(backend.MsgDump, []byte(output))
+			}
+		case backend.MsgPing:
+			_ = c.WriteFrame(backend.MsgPong, nil)
+		case backend.MsgPong:
+			if client != nil {
+				s.mu.Lock()
+				client.lastPong = time.Now()
+				s.mu.Unlock()
+			}
+		case backend.MsgWatch:
+			s.watchPane(c, payload)
+			return
+		case backend.MsgAttach:
+			if client != nil {
+				continue
+			}
+			var attach backend.Attach
+			if len(payload) > 0 {
+				_ = json.Unmarshal(payload, &attach)
+			}
+			if attach.DetachOthers && p.guest {
+				_ = c.WriteFrame(backend.MsgError, []byte("only the owner of the session may detach other clients"))
+				return
+			}
+			client = s.addClient(c, readOnly, p, attach)
+		case backend.MsgInput:
+			if readOnly {
+				continue
+			}
+			var ptmx *os.File
+			s.mu.Lock()
+			if client != nil {
+				s.lastClient = client
+			}
+			if w := s.activeWindowLocked(); w != nil && !w.activePane.dead {
+				ptmx = w.activePane.ptmx
+			}
+			s.mu.Unlock()
+			if ptmx != nil {
+				_, _ = ptmx.Write(payload)
+			}
+		case backend.MsgResize:
+			cols, rows, err := backend.DecodeSize(payload)
+			if err != nil || client == nil {
+				continue
+			}
+			s.resizeClient(client, cols, rows)
+		case backend.MsgKill:
+			if readOnly || p.guest {
+				continue
+			}
+			s.killAll()
+		case backend.MsgCommand:
+			var command backend.Command
+			var result backend.CommandResult
+			if err := json.Unmarshal(payload, &command); err != nil {
+				result.Error = fmt.Sprintf("malformed command: %v", err)
+			} else if p.guest && ownerOnlyCommands[command.Name] {
+				result.Error = fmt.Sprintf("%s is only allowed for the owner of the session", command.Name)
+			} else if readOnly && !readOnlyCommands[command.Name] {
+				result.Error = fmt.Sprintf("%s is not allowed on a read-only connection", command.Name)
+			} else if data, err := s.runCommand(command); err != nil {
+				result.Error = err.Error()
+			} else if data != nil {
+				result.Data, _ = json.Marshal(data)
+			}
+			reply, _ := json.Marshal(result)
+			_ = c.WriteFrame(backend.MsgCommand, reply)
+		default:
+			_ = c.WriteFrame(backend.MsgError, []byte(fmt.Sprintf("unknown message type 0x%02x", typ)))
+		}
+	}
+}
+
+// status describes the session for `txm list`.
+func (s *nativeServer) status() backend.SessionStatus {
+	s.mu.Lock()
+	st := backend.SessionStatus{
+		Created:    s.created,
+		LastAttach: s.lastAttach,
+		Command:    s.command,
+		Windows:    len(s.windows),
+		Clients:    len(s.clients),
+		ReadOnly:   s.readOnlyClientsLocked(),
+		LogFile:    s.logFile,
+		Recording:  s.recordPath,
+	}
+	var ptmx *os.File
+	if w := s.activeWindowLocked(); w != nil {
+		p := w.activePane
+		st.Cols, st.Rows = p.cols, p.rows
+		if p.cmd.Process != nil {
+			st.PID = p.cmd.Process.Pid
+		}
+		if p.dead {
+			st.ExitStatus = p.exitStatus
+		} else {
+			ptmx = p.ptmx
+		}
+	}
+	st.Dead = len(s.windows) > 0
+	for _, w := range s.windows {
+		if len(deadPanes(w.panes)) < len(w.panes) {
+			st.Dead = false
+		}
 	}
+	s.mu.Unlock()
 
-	return &rotatingFileWriter{
-		filename: filename,
-		maxSize:  maxSize,
-		file:     f,
-		size:     size,
-	}, nil
+	// Looking up the foreground process may run ps, so it happens without
+	// holding up the panes' output.
+	if ptmx != nil {
+		st.Foreground = foregroundProcess(ptmx)
+	}
+	return st
 }
 
-func (r *rotatingFileWriter) Write(p []byte) (n int, err error) {
-	if r == nil {
-		return len(p), nil
+// renameSession moves the listening socket to the path of the new name.
+// The socket is hard linked to its new path before the old path is removed,
+// so the session is reachable at all times and a clash with an existing
+// session is detected atomically. Attached clients are unaffected.
+func (s *nativeServer) renameSession(newName string) error {
+	if err := validateName(newName); err != nil {
+		return err
 	}
-	r.mu.Lock()
-	defer r.mu.Unlock()
 
-	n, err = r.file.Write(p)
-	r.size += n
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if r.size >= r.maxSize {
-		r.rotate()
+	newPath, err := backend.SocketPath(newName)
+	if err != nil {
+		return err
+	}
+	if err := os.Link(s.socketPath, newPath); err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("session %s already exists", newName)
+		}
+		return fmt.Errorf("failed to move socket: %v", err)
+	}
+	if err := os.Remove(s.socketPath); err != nil {
+		_ = os.Remove(newPath)
+		return fmt.Errorf("failed to move socket: %v", err)
 	}
-	return n, err
+	_ = os.Rename(backend.InfoPath(s.socketPath), backend.InfoPath(newPath))
+	s.renameSharedLocked(newName)
+	s.name = newName
+	s.socketPath = newPath
+	return nil
 }
 
-func (r *rotatingFileWriter) rotate() {
-	_ = r.file.Close()
-	_ = os.Rename(r.filename, r.filename+".1")
-	f, err := os.OpenFile(r.filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
-	if err == nil {
-		r.file = f
-		r.size = 0
+// childEnvLocked returns the environment for processes started in the
+// session. TXM_SESSION names the session as of the moment the process
+// starts, while TXM_SESSION_ID stays valid across renames. Variables and
+// TERM given to txm create come last so that they win. s.mu must be held.
+func (s *nativeServer) childEnvLocked() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "TXM_SESSION=") || strings.HasPrefix(kv, "TXM_SESSION_ID=") ||
+			strings.HasPrefix(kv, "TXM_SPAWN=") {
+			continue
+		}
+		env = append(env, kv)
 	}
+	env = append(env, s.spawn.Environ()...)
+	return append(env, "TXM_SESSION="+s.name, "TXM_SESSION_ID="+s.id)
 }
 
-func (r *rotatingFileWriter) Close() error {
-	if r == nil || r.file == nil {
-		return nil
+// readOnlyCommands are the commands a read-only connection may run.
+var readOnlyCommands = map[string]bool{
+	"session-id":   true,
+	"list-windows": true,
+	"list-panes":   true,
+	"capture-pane": true,
+	"list-clients": true,
+}
+
+// runCommand executes a control command sent by the txm CLI and returns the
+// value to send back to it, if any.
+func (s *nativeServer) runCommand(c backend.Command) (interface{}, error) {
+	arg := func(i int) string {
+		if i < len(c.Args) {
+			return c.Args[i]
+		}
+		return ""
+	}
+
+	switch c.Name {
+	case "session-id":
+		return s.id, nil
+	case "detach-client":
+		return nil, s.detachClient(arg(0))
+	case "list-clients":
+		return s.listClients(), nil
+	case "kick-client":
+		return nil, s.kickClient(arg(0))
+	case "rename-session":
+		return nil, s.renameSession(arg(0))
+	case "new-window":
+		// Like tmux, a new window starts the user's shell rather than
+		// the command the session was created with.
+		_, err := s.newWindow(arg(0), nil)
+		return nil, err
+	case "list-windows":
+		return s.listWindows(), nil
+	case "kill-window":
+		return nil, s.killWindow(arg(0))
+	case "select-window":
+		return nil, s.selectWindow(arg(0))
+	case "rename-window":
+		return nil, s.renameWindow(arg(0), arg(1))
+	case "split-window":
+		return nil, s.splitWindow(arg(0), arg(1))
+	case "list-panes":
+		return s.listPanes(arg(0))
+	case "kill-pane":
+		return nil, s.killPane(arg(0), arg(1))
+	case "select-pane":
+		return nil, s.selectPane(arg(0), arg(1))
+	case "capture-pane":
+		s.mu.Lock()
+		p, err := s.findPaneLocked(arg(0), arg(1))
+		s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return p.text()
+	case "respawn":
+		return nil, s.respawn(arg(0), arg(1))
+	case "record-start":
+		return nil, s.startRecording(arg(0))
+	case "record-stop":
+		return nil, s.stopRecording()
+	case "set-buffer":
+		return nil, s.setBuffer(arg(0))
+	case "list-buffers":
+		return s.listBuffers(), nil
+	case "paste-buffer":
+		return nil, s.pasteBuffer(arg(0))
+	case "size-policy":
+		return s.setSizePolicy(arg(0))
+	case "share":
+		return nil, s.share(arg(0), arg(1))
+	case "unshare":
+		return nil, s.unshare(arg(0))
+	case "list-shares":
+		return s.listShares(), nil
+	case "send":
+		s.mu.Lock()
+		p, err := s.findPaneLocked(arg(0), arg(1))
+		if err == nil && p.dead {
+			err = fmt.Errorf("pane %d is dead", p.id)
+		}
+		var ptmx *os.File
+		if err == nil {
+			ptmx = p.ptmx
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		_, err = ptmx.Write([]byte(arg(2)))
+		return nil, err
+	default:
+		return nil, fmt.Errorf("unknown command %q", c.Name)
 	}
-	return r.file.Close()
 }
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxBuffers bounds the paste buffers a session keeps; the oldest buffer is
+// dropped first.
+const maxBuffers = 50
+
+// setBuffer adds a paste buffer, usually a selection copied in copy mode.
+func (s *nativeServer) setBuffer(text string) error {
+	if text == "" {
+		return fmt.Errorf("empty buffer")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffers = append([]string{text}, s.buffers...)
+	if len(s.buffers) > maxBuffers {
+		s.buffers = s.buffers[:maxBuffers]
+	}
+	return nil
+}
+
+func (s *nativeServer) listBuffers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.buffers...)
+}
+
+// pasteBuffer types a buffer into the active pane. Line feeds are sent as
+// carriage returns, which is what the Enter key produces.
+func (s *nativeServer) pasteBuffer(index string) error {
+	i := 0
+	if index != "" {
+		var err error
+		if i, err = strconv.Atoi(index); err != nil {
+			return fmt.Errorf("invalid buffer index %q", index)
+		}
+	}
+
+	var ptmx *os.File
+	var text string
+	s.mu.Lock()
+	if i < 0 || i >= len(s.buffers) {
+		s.mu.Unlock()
+		return fmt.Errorf("no buffer %d", i)
+	}
+	text = s.buffers[i]
+	if w := s.activeWindowLocked(); w != nil && !w.activePane.dead {
+		ptmx = w.activePane.ptmx
+	}
+	s.mu.Unlock()
+	if ptmx == nil {
+		return fmt.Errorf("the active pane is dead")
+	}
+	_, err := ptmx.Write([]byte(strings.ReplaceAll(text, "\n", "\r")))
+	return err
+}
@@ -0,0 +1,420 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+// clientQueueSize bounds the frames waiting to be written to a client. A
+// client that falls this far behind is resynced with a fresh screen.
+const clientQueueSize = 128
+
+// clientFrame is a frame waiting in a client's queue.
+type clientFrame struct {
+	typ  byte
+	data []byte
+}
+
+// serverClient is a connection attached to the session's screen.
+type serverClient struct {
+	id       int
+	conn     *backend.FrameConn
+	readOnly bool
+	uid      int
+	pid      int
+	guest    bool
+	tty      string
+	attached time.Time
+
+	// cols and rows are the size of the client's terminal, zero until it
+	// reports one. framed clients are sent frames rendered at that size
+	// instead of the output of the session, because they asked for
+	// synchronized rendering with sync or the session has a different
+	// size. frame is the last frame sent, which the next one is diffed
+	// against, and viewport the part of the session it shows. Guarded by
+	// s.mu.
+	cols, rows uint16
+	sync       bool
+	framed     bool
+	frame      *frame
+	frameAt    time.Time
+	viewport   viewport
+
+	// lastPong is when the client last answered a heartbeat, zero for
+	// clients that never did. Guarded by s.mu.
+	lastPong time.Time
+
+	// queue holds the frames for writeLoop, which writes them to the
+	// connection so that a slow client never holds up the others. When
+	// the queue overflows its output is dropped and stale is set until
+	// writeLoop has sent a fresh screen in its place; control frames such
+	// as pings and detaches are kept. stale is guarded by s.mu; done is
+	// closed when the client is removed.
+	queue  chan clientFrame
+	resync chan struct{}
+	stale  bool
+	done   chan struct{}
+}
+
+// addClient registers an attached connection and sends it the current
+// screen, after detaching the other clients when the attach asks for it.
+// Attaches by guests are recorded in the audit log.
+func (s *nativeServer) addClient(conn *backend.FrameConn, readOnly bool, p peer, attach backend.Attach) *serverClient {
+	// readPane writes output to the terminals and queues it under s.mu,
+	// so holding it across the snapshot means the client gets exactly the
+	// output after it.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attach.DetachOthers {
+		for _, c := range s.clients {
+			c.detachLocked(backend.DetachKicked)
+		}
+	}
+	c := &serverClient{
+		id:       s.nextClientID,
+		conn:     conn,
+		readOnly: readOnly,
+		uid:      p.uid,
+		pid:      p.pid,
+		guest:    p.guest,
+		tty:      attach.TTY,
+		sync:     attach.Sync,
+		attached: time.Now(),
+		queue:    make(chan clientFrame, clientQueueSize),
+		resync:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if w := s.activeWindowLocked(); w != nil {
+		if output, err := s.screenLocked(w); err == nil {
+			s.enqueueLocked(c, backend.MsgOutput, []byte(output))
+		}
+	}
+	s.writers.Add(1)
+	go s.writeLoop(c)
+	s.nextClientID++
+	if p.guest {
+		mode := "read-write"
+		if readOnly {
+			mode = "read-only"
+		}
+		s.auditLocked("attach uid=%d pid=%d client=%d mode=%s", p.uid, p.pid, c.id, mode)
+	}
+	s.clients = append(s.clients, c)
+	s.lastAttach = c.attached
+	return c
+}
+
+// detachLocked tells the client to detach, after the output queued for it,
+// with a reason for the client to show, and disconnects it. A client whose
+// queue is full is disconnected right away. s.mu must be held.
+func (c *serverClient) detachLocked(reason string) {
+	select {
+	case c.queue <- clientFrame{backend.MsgDetach, []byte(reason)}:
+	default:
+		_ = c.conn.Close()
+	}
+}
+
+// enqueueLocked queues a frame for a client. When the queue is full the
+// client has fallen behind: the output queued for it is dropped and
+// writeLoop is asked to send the current screen instead, unless the client
+// is being detached anyway. Control frames stay queued in order; a client
+// whose queue holds nothing else is disconnected. s.mu must be held.
+func (s *nativeServer) enqueueLocked(c *serverClient, typ byte, data []byte) {
+	output := typ == backend.MsgOutput || typ == backend.MsgDump
+	if c.stale && output {
+		return
+	}
+	select {
+	case c.queue <- clientFrame{typ, data}:
+		return
+	default:
+	}
+
+	var control []clientFrame
+	detaching := false
+	for len(c.queue) > 0 {
+		select {
+		case f := <-c.queue:
+			if f.typ != backend.MsgOutput && f.typ != backend.MsgDump {
+				control = append(control, f)
+				detaching = detaching || f.typ == backend.MsgDetach
+			}
+		default:
+		}
+	}
+	if !output {
+		control = append(control, clientFrame{typ, data})
+	}
+	if len(control) > cap(c.queue) {
+		_ = c.conn.Close()
+		return
+	}
+	for _, f := range control {
+		c.queue <- f
+	}
+	if !c.stale {
+		c.stale = true
+		if !detaching {
+			c.resync <- struct{}{}
+		}
+	}
+}
+
+// writeLoop writes the frames queued for a client until the client is
+// removed, detached or stops accepting data for HeartbeatTimeout.
+func (s *nativeServer) writeLoop(c *serverClient) {
+	defer s.writers.Done()
+	for {
+		var f clientFrame
+		select {
+		case <-c.done:
+			return
+		case f = <-c.queue:
+		case <-c.resync:
+			data, ok := s.resyncClient(c)
+			if !ok {
+				continue
+			}
+			f = clientFrame{backend.MsgOutput, data}
+		}
+		_ = c.conn.SetWriteDeadline(time.Now().Add(backend.HeartbeatTimeout))
+		if err := c.conn.WriteFrame(f.typ, f.data); err != nil || f.typ == backend.MsgDetach {
+			_ = c.conn.Close()
+			return
+		}
+	}
+}
+
+// resyncAttempts is how often resyncClient draws the screen without s.mu
+// before it gives up and draws it with s.mu held.
+const resyncAttempts = 3
+
+// resyncClient returns the screen that replaces the output a stale client
+// missed and clears stale, or reports false for framed clients, which get
+// a whole frame from the next render instead. No output is queued while
+// the client is stale, so the screen is followed by exactly the output
+// after it. The screen is drawn without s.mu, and drawn again when output
+// or a redraw came in meanwhile.
+func (s *nativeServer) resyncClient(c *serverClient) ([]byte, bool) {
+	for attempt := 0; ; attempt++ {
+		s.mu.Lock()
+		if c.framed {
+			c.stale = false
+			c.frame = nil
+			s.scheduleRenderLocked()
+			s.mu.Unlock()
+			return nil, false
+		}
+		if attempt == resyncAttempts {
+			c.stale = false
+			data := s.clientScreenLocked(c)
+			s.mu.Unlock()
+			return []byte(data), true
+		}
+		outputs, screens := s.outputs, s.screens
+		render := s.screenCopyLocked()
+		s.mu.Unlock()
+
+		data := render()
+		s.mu.Lock()
+		if s.outputs == outputs && s.screens == screens && !c.framed {
+			c.stale = false
+			s.mu.Unlock()
+			return []byte(data), true
+		}
+		s.mu.Unlock()
+	}
+}
+
+// clientScreenLocked renders what a client should see to replace its
+// whole screen. Framed clients diff their next frame against it. s.mu must
+// be held.
+func (s *nativeServer) clientScreenLocked(c *serverClient) string {
+	w := s.activeWindowLocked()
+	if w == nil {
+		return ""
+	}
+	if c.framed {
+		c.frame, c.frameAt = s.viewLocked(w, c.cols, c.rows, &c.viewport).frame(), time.Now()
+		return c.frame.render()
+	}
+	output, err := s.screenLocked(w)
+	if err != nil {
+		return ""
+	}
+	return "\x1b[H\x1b[2J" + output
+}
+
+// screenCopyLocked copies what it takes to draw the active window as
+// clients of the session size see it, to be drawn without s.mu by the
+// function it returns: the VT snapshot of its only pane, like on attach, or
+// the composited frame of its panes. s.mu must be held.
+func (s *nativeServer) screenCopyLocked() func() string {
+	w := s.activeWindowLocked()
+	switch {
+	case w == nil:
+		return func() string { return "" }
+	case len(w.panes) == 1:
+		p := w.panes[0]
+		return func() string {
+			output, _ := p.snapshot()
+			return "\x1b[H\x1b[2J" + output
+		}
+	}
+	wc := s.copyWindowLocked(w)
+	return func() string {
+		wc.format()
+		return wc.view().frame().render()
+	}
+}
+
+// heartbeatLoop pings the attached clients and disconnects those that
+// stopped answering, until stop is closed.
+func (s *nativeServer) heartbeatLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(backend.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		for _, c := range s.clients {
+			if !c.lastPong.IsZero() && time.Since(c.lastPong) > backend.HeartbeatTimeout {
+				_ = c.conn.Close()
+				continue
+			}
+			s.enqueueLocked(c, backend.MsgPing, nil)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// detachAllLocked tells every attached client that the session ended.
+// s.mu must be held.
+func (s *nativeServer) detachAllLocked() {
+	for _, c := range s.clients {
+		c.detachLocked(backend.DetachExited)
+	}
+}
+
+func (s *nativeServer) removeClient(c *serverClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.clients {
+		if existing == c {
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
+			close(c.done)
+			break
+		}
+	}
+	if s.lastClient == c {
+		s.lastClient = nil
+	}
+	if s.sizeClient == c {
+		s.sizeClient = nil
+	}
+	s.applySizeLocked()
+}
+
+// readOnlyClientsLocked counts the attached read-only clients. s.mu must be
+// held.
+func (s *nativeServer) readOnlyClientsLocked() int {
+	n := 0
+	for _, c := range s.clients {
+		if c.readOnly {
+			n++
+		}
+	}
+	return n
+}
+
+// detachClient tells attached clients to detach and disconnects them. The
+// target is a client id, "all", or empty for the client that most recently
+// typed into the session, which is the one running `txm detach` from inside.
+func (s *nativeServer) detachClient(target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var victims []*serverClient
+	switch target {
+	case "all":
+		victims = append(victims, s.clients...)
+	case "":
+		if s.lastClient != nil {
+			victims = append(victims, s.lastClient)
+		} else if len(s.clients) > 0 {
+			victims = append(victims, s.clients[len(s.clients)-1])
+		}
+	default:
+		id, err := strconv.Atoi(target)
+		if err != nil {
+			return fmt.Errorf("invalid client id %q", target)
+		}
+		for _, c := range s.clients {
+			if c.id == id {
+				victims = append(victims, c)
+			}
+		}
+		if len(victims) == 0 {
+			return fmt.Errorf("client %d is not attached", id)
+		}
+	}
+	if len(victims) == 0 {
+		return fmt.Errorf("no clients attached")
+	}
+
+	for _, c := range victims {
+		c.detachLocked("")
+	}
+	return nil
+}
+
+// kickClient forces one client off the session. Unlike detachClient it
+// tells the client that someone else detached it.
+func (s *nativeServer) kickClient(target string) error {
+	id, err := strconv.Atoi(target)
+	if err != nil {
+		return fmt.Errorf("invalid client id %q", target)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.clients {
+		if c.id == id {
+			c.detachLocked(backend.DetachKicked)
+			return nil
+		}
+	}
+	return fmt.Errorf("client %d is not attached", id)
+}
+
+// listClients describes the attached clients in the order they attached.
+func (s *nativeServer) listClients() []backend.ClientInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clients := make([]backend.ClientInfo, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, backend.ClientInfo{
+			ID:       c.id,
+			PID:      c.pid,
+			UID:      c.uid,
+			TTY:      c.tty,
+			Cols:     c.cols,
+			Rows:     c.rows,
+			ReadOnly: c.readOnly,
+			Sync:     c.sync,
+			Attached: c.attached,
+		})
+	}
+	return clients
+}
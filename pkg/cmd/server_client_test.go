@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+func TestClientQueueResync(t *testing.T) {
+	server, client := net.Pipe()
+	defer func() { _ = client.Close() }()
+	s := &nativeServer{}
+	c := &serverClient{
+		conn:   backend.NewFrameConn(server),
+		queue:  make(chan clientFrame, clientQueueSize),
+		resync: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	for i := 0; i <= clientQueueSize; i++ {
+		s.enqueueLocked(c, backend.MsgOutput, []byte("old"))
+		if i == clientQueueSize/2 {
+			s.enqueueLocked(c, backend.MsgPing, nil)
+		}
+	}
+	s.enqueueLocked(c, backend.MsgOutput, []byte("dropped"))
+	if !c.stale || len(c.queue) != 1 || len(c.resync) != 1 {
+		t.Fatalf("after overflow: stale %t, %d queued, %d resyncs; want the ping and a pending resync", c.stale, len(c.queue), len(c.resync))
+	}
+	s.mu.Unlock()
+
+	s.writers.Add(1)
+	go s.writeLoop(c)
+	fc := backend.NewFrameConn(client)
+	got := map[byte]bool{}
+	for range 2 {
+		typ, _, err := fc.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[typ] = true
+	}
+	if !got[backend.MsgPing] || !got[backend.MsgOutput] {
+		t.Fatalf("frames after overflow = %v; want the ping and the screen", got)
+	}
+
+	s.mu.Lock()
+	s.enqueueLocked(c, backend.MsgOutput, []byte("new"))
+	s.mu.Unlock()
+	if _, data, err := fc.ReadFrame(); err != nil || string(data) != "new" {
+		t.Fatalf("frame after resync = %q, %v; want new", data, err)
+	}
+
+	s.mu.Lock()
+	c.detachLocked(backend.DetachKicked)
+	s.mu.Unlock()
+	if typ, data, err := fc.ReadFrame(); err != nil || typ != backend.MsgDetach || string(data) != backend.DetachKicked {
+		t.Fatalf("detach frame = 0x%02x %q, %v", typ, data, err)
+	}
+	s.writers.Wait()
+
+	// A client with a detach queued is not sent a screen before it goes.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c = &serverClient{
+		conn:   backend.NewFrameConn(server),
+		queue:  make(chan clientFrame, clientQueueSize),
+		resync: make(chan struct{}, 1),
+	}
+	for range clientQueueSize - 1 {
+		s.enqueueLocked(c, backend.MsgOutput, []byte("old"))
+	}
+	c.detachLocked(backend.DetachKicked)
+	s.enqueueLocked(c, backend.MsgOutput, []byte("dropped"))
+	if len(c.queue) != 1 || len(c.resync) != 0 {
+		t.Fatalf("overflow while detaching: %d queued, %d resyncs; want the detach only", len(c.queue), len(c.resync))
+	}
+	if f := <-c.queue; f.typ != backend.MsgDetach {
+		t.Errorf("queued frame = 0x%02x; want the detach", f.typ)
+	}
+}
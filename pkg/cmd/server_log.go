@@ -0,0 +1,400 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logOptions configure a session log.
+type logOptions struct {
+	maxSize     int  // rotate once the file reaches this many bytes
+	generations int  // rotated files to keep as .1, .2, ...
+	compress    bool // gzip rotated files
+	timestamps  bool // prefix every line with the time it started
+}
+
+// rotatingFileWriter appends to a log file and rotates it by size, keeping
+// a number of older generations.
+type rotatingFileWriter struct {
+	filename string
+	opts     logOptions
+	file     *os.File
+	size     int
+	midLine  bool // the last write did not end a line
+	mu       sync.Mutex
+
+	// compressing is closed when the gzip of the last rotated file, which
+	// runs in the background, is done. It is nil when no gzip runs; the
+	// next rotation waits for it outside mu.
+	compressing chan struct{}
+}
+
+func newRotatingFileWriter(filename string, opts logOptions) (*rotatingFileWriter, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	var size int
+	info, err := os.Stat(filename)
+	if err == nil {
+		size = int(info.Size())
+	}
+
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rotatingFileWriter{
+		filename: filename,
+		opts:     opts,
+		file:     f,
+		size:     size,
+		midLine:  size > 0,
+	}, nil
+}
+
+func (r *rotatingFileWriter) Write(p []byte) (n int, err error) {
+	if r == nil {
+		return len(p), nil
+	}
+	r.mu.Lock()
+	data := p
+	if r.opts.timestamps {
+		data = r.stampLines(p)
+	}
+	written, err := r.file.Write(data)
+	r.size += written
+	full := r.size >= r.opts.maxSize
+	r.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if full {
+		r.rotate()
+	}
+	return len(p), nil
+}
+
+// stampLines prefixes every line that starts in p with the current time.
+func (r *rotatingFileWriter) stampLines(p []byte) []byte {
+	stamp := time.Now().Format(time.RFC3339) + " "
+	var buf bytes.Buffer
+	for len(p) > 0 {
+		if !r.midLine {
+			buf.WriteString(stamp)
+		}
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			buf.Write(p)
+			r.midLine = true
+			break
+		}
+		buf.Write(p[:i+1])
+		r.midLine = false
+		p = p[i+1:]
+	}
+	return buf.Bytes()
+}
+
+// generation returns the path of the nth rotated file.
+func (r *rotatingFileWriter) generation(n int) string {
+	path := fmt.Sprintf("%s.%d", r.filename, n)
+	if r.opts.compress {
+		path += ".gz"
+	}
+	return path
+}
+
+// rotate shifts the rotated files by one generation, dropping the oldest,
+// and starts a new file, unless another write rotated the log already.
+// Without generations the log is truncated. The file rotated out is
+// compressed in the background; the next rotation waits for it without
+// holding up the writes in between.
+func (r *rotatingFileWriter) rotate() {
+	r.mu.Lock()
+	for r.compressing != nil {
+		done := r.compressing
+		r.mu.Unlock()
+		<-done
+		r.mu.Lock()
+	}
+	defer r.mu.Unlock()
+	if r.size < r.opts.maxSize {
+		return
+	}
+
+	_ = r.file.Close()
+	if r.opts.generations > 0 {
+		_ = os.Remove(r.generation(r.opts.generations))
+		for n := r.opts.generations - 1; n >= 1; n-- {
+			_ = os.Rename(r.generation(n), r.generation(n+1))
+		}
+		first := fmt.Sprintf("%s.1", r.filename)
+		_ = os.Rename(r.filename, first)
+		if r.opts.compress {
+			done := make(chan struct{})
+			r.compressing = done
+			go func(dst string) {
+				if err := gzipFile(first, dst); err == nil {
+					_ = os.Remove(first)
+				}
+				r.mu.Lock()
+				r.compressing = nil
+				r.mu.Unlock()
+				close(done)
+			}(r.generation(1))
+		}
+	}
+	f, err := os.OpenFile(r.filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err == nil {
+		r.file = f
+		r.size = 0
+	}
+}
+
+// gzipFile compresses src into dst.
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// Close closes the log once the rotated file is compressed.
+func (r *rotatingFileWriter) Close() error {
+	if r == nil || r.file == nil {
+		return nil
+	}
+	r.mu.Lock()
+	done := r.compressing
+	r.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	return r.file.Close()
+}
+
+// In plain log mode the session log holds the text of lines as the pane's
+// terminal rendered them instead of the raw PTY output. A line is logged
+// once it scrolls off the screen into the scrollback, since until then the
+// program may still redraw it; the lines still on screen are logged when
+// the pane exits or is killed, and before output erases the screen.
+
+// logTailLines is how many logged lines a pane remembers to find its place
+// in the scrollback again once the scrollback is full and drops old lines.
+const logTailLines = 8
+
+// plainLogInterval is how often panes with new output are checked for
+// lines that scrolled off.
+const plainLogInterval = time.Second
+
+// eraseSequences erase the screen or the scrollback, so the lines on the
+// screen are logged before them. Sequences split across two reads from the
+// PTY are not noticed.
+var eraseSequences = [][]byte{
+	[]byte("\x1b[2J"),
+	[]byte("\x1b[3J"),
+	[]byte("\x1bc"),
+}
+
+// eraseIndex returns where the first sequence in data that erases the
+// screen starts and its length, or -1.
+func eraseIndex(data []byte) (int, int) {
+	index, length := -1, 0
+	for _, seq := range eraseSequences {
+		if i := bytes.Index(data, seq); i >= 0 && (index < 0 || i < index) {
+			index, length = i, len(seq)
+		}
+	}
+	return index, length
+}
+
+// plainLogLoop logs the lines that scrolled off the panes with new output
+// until stop is closed.
+func (s *nativeServer) plainLogLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(plainLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		type pending struct {
+			p    *serverPane
+			rows int
+		}
+		var panes []pending
+		s.mu.Lock()
+		for _, w := range s.windows {
+			for _, p := range w.panes {
+				if p.logPending {
+					p.logPending = false
+					panes = append(panes, pending{p, int(p.rows)})
+				}
+			}
+		}
+		s.mu.Unlock()
+
+		for _, pp := range panes {
+			s.logPaneLines(pp.p, pp.rows, false)
+		}
+	}
+}
+
+// logPaneLines writes the lines of a pane that have not been logged yet:
+// those in the scrollback or, when final is set, all of them. It does not
+// need s.mu, so it can be called with or without it.
+func (s *nativeServer) logPaneLines(p *serverPane, rows int, final bool) {
+	text, err := p.text()
+	if err != nil {
+		return
+	}
+	lines := trimBlankLines(splitLines(text))
+	if !final {
+		lines = lines[:max(len(lines)-rows, 0)]
+	}
+
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	// Fewer lines than were logged are left in the scrollback after the
+	// screen was erased; the lines after them are still on the screen.
+	if !final && len(lines) < p.logCount {
+		return
+	}
+	s.logFreshLinesLocked(p, lines, final)
+}
+
+// logScreenLines writes the lines of a pane that have not been logged yet,
+// including those on its screen, before output erases the screen. The
+// lines logged from the screen are remembered so that they are not logged
+// again if the terminal moves them into the scrollback. It does not need
+// s.mu, so it can be called with or without it.
+func (s *nativeServer) logScreenLines(p *serverPane, rows int) {
+	text, err := p.text()
+	if err != nil {
+		return
+	}
+	lines := splitLines(text)
+
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	s.logFreshLinesLocked(p, trimBlankLines(lines), true)
+	scrollback := lines[:max(len(lines)-rows, 0)]
+	p.logCount = len(scrollback)
+	p.logTail = append([]string(nil), scrollback[max(len(scrollback)-logTailLines, 0):]...)
+	p.logErased = trimBlankLines(append([]string(nil), lines[len(scrollback):]...))
+}
+
+// logFreshLinesLocked writes the lines of a pane after the ones already
+// logged, leaving out an erased screen that was logged before, and records
+// them as logged. s.logMu must be held.
+func (s *nativeServer) logFreshLinesLocked(p *serverPane, lines []string, final bool) {
+	fresh := unloggedLines(lines, p.logTail, p.logCount)
+	if len(p.logErased) > 0 && len(fresh) > 0 {
+		var partial bool
+		fresh, partial = skipErased(fresh, p.logErased)
+		if partial && !final {
+			return
+		}
+		p.logErased = nil
+	}
+	if len(fresh) > 0 {
+		var buf bytes.Buffer
+		for _, line := range fresh {
+			buf.WriteString(strings.TrimRight(line, " "))
+			buf.WriteByte('\n')
+		}
+		_, _ = s.logWriter.Write(buf.Bytes())
+	}
+
+	p.logCount = len(lines)
+	p.logTail = append([]string(nil), lines[max(len(lines)-logTailLines, 0):]...)
+}
+
+// skipErased drops the lines of an erased screen, and the blank rows below
+// them, from the start of fresh, where they show up when the terminal
+// moved the screen into the scrollback. partial reports that fresh holds
+// only the first lines of the erased screen so far.
+func skipErased(fresh, erased []string) (rest []string, partial bool) {
+	n := min(len(fresh), len(erased))
+	if !slices.Equal(fresh[:n], erased[:n]) {
+		return fresh, false
+	}
+	if n < len(erased) {
+		return nil, true
+	}
+	rest = fresh[n:]
+	for len(rest) > 0 && strings.TrimSpace(rest[0]) == "" {
+		rest = rest[1:]
+	}
+	return rest, false
+}
+
+// splitLines splits a plain text rendering into lines.
+func splitLines(text string) []string {
+	return strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+}
+
+// trimBlankLines drops the blank lines at the end of lines.
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// unloggedLines returns the lines after the ones already logged. Those end
+// at index count unless the scrollback dropped lines from its top, in which
+// case they are found again by the last lines logged, tail.
+func unloggedLines(lines, tail []string, count int) []string {
+	if len(tail) == 0 {
+		return lines
+	}
+	matches := func(end int) bool {
+		if end < len(tail) || end > len(lines) {
+			return false
+		}
+		for i, line := range tail {
+			if lines[end-len(tail)+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+	if matches(count) {
+		return lines[count:]
+	}
+	for end := len(lines); end >= len(tail); end-- {
+		if matches(end) {
+			return lines[end:]
+		}
+	}
+	return lines
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFileWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.log")
+	w, err := newRotatingFileWriter(path, logOptions{maxSize: 10, generations: 2, compress: true, timestamps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range []string{"second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = w.Close()
+
+	readGzip := func(path string) string {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(zr)
+		return string(data)
+	}
+	stamped := regexp.MustCompile(`^\d{4}-\d\d-\d\dT\S+ (\w+)\n$`)
+
+	// Every line rotates the log, so the oldest generation is dropped.
+	for file, want := range map[string]string{path + ".1.gz": "fourth", path + ".2.gz": "third"} {
+		m := stamped.FindStringSubmatch(readGzip(file))
+		if m == nil || m[1] != want {
+			t.Errorf("%s holds %q; want a stamped %q", filepath.Base(file), readGzip(file), want)
+		}
+	}
+	if _, err := os.Stat(path + ".3.gz"); err == nil {
+		t.Error("kept a third generation")
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("current log holds %q; want it empty", data)
+	}
+
+	// A line written in pieces gets a single stamp.
+	w.midLine = false
+	got := string(w.stampLines([]byte("a"))) + string(w.stampLines([]byte("b\nc")))
+	if m := regexp.MustCompile(`^\S+ ab\n\S+ c$`); !m.MatchString(got) {
+		t.Errorf("stamped pieces as %q", got)
+	}
+}
+
+func TestUnloggedLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		tail  []string
+		count int
+		want  []string
+	}{
+		{"Nothing logged yet", []string{"a", "b"}, nil, 0, []string{"a", "b"}},
+		{"Appended lines", []string{"a", "b", "c"}, []string{"a", "b"}, 2, []string{"c"}},
+		{"Repeated lines", []string{"ok", "ok", "ok"}, []string{"ok", "ok"}, 2, []string{"ok"}},
+		{"Scrollback dropped lines", []string{"b", "c", "d"}, []string{"a", "b", "c"}[1:], 3, []string{"d"}},
+		{"Lost track", []string{"x", "y"}, []string{"a"}, 1, []string{"x", "y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unloggedLines(tt.lines, tt.tail, tt.count)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("unloggedLines = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipErased(t *testing.T) {
+	erased := []string{"$ make", "ok"}
+	tests := []struct {
+		name        string
+		fresh       []string
+		want        []string
+		wantPartial bool
+	}{
+		{"Screen moved to the scrollback", []string{"$ make", "ok", "", "", "$ ls"}, []string{"$ ls"}, false},
+		{"Screen partly in the scrollback", []string{"$ make"}, nil, true},
+		{"Screen dropped", []string{"$ ls", "a"}, []string{"$ ls", "a"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, partial := skipErased(tt.fresh, erased)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || partial != tt.wantPartial {
+				t.Errorf("skipErased = %q, %v; want %q, %v", got, partial, tt.want, tt.wantPartial)
+			}
+		})
+	}
+
+	if i, n := eraseIndex([]byte("ab\x1b[3J\x1b[H\x1b[2J")); i != 2 || n != 4 {
+		t.Errorf("eraseIndex = %d, %d; want 2, 4", i, n)
+	}
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MohamedElashri/txm/pkg/asciicast"
+)
+
+// startRecordingLocked starts an asciicast recording of what attached
+// clients see, beginning with the current screen. s.mu must be held.
+func (s *nativeServer) startRecordingLocked(path string) error {
+	if s.recorder != nil {
+		return fmt.Errorf("session is already being recorded to %s", s.recordPath)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open recording: %v", err)
+	}
+	rec, err := asciicast.NewWriter(f, asciicast.Header{
+		Width:  int(s.cols),
+		Height: int(s.rows),
+		Title:  s.name,
+		Env:    map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	})
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write recording: %v", err)
+	}
+	s.recorder, s.recordPath = rec, path
+
+	if w := s.activeWindowLocked(); w != nil {
+		if output, err := s.screenLocked(w); err == nil {
+			_ = rec.Output([]byte("\x1b[H\x1b[2J" + output))
+		}
+	}
+	return nil
+}
+
+// stopRecordingLocked finishes the current recording. s.mu must be held.
+func (s *nativeServer) stopRecordingLocked() error {
+	if s.recorder == nil {
+		return fmt.Errorf("session is not being recorded")
+	}
+	err := s.recorder.Close()
+	s.recorder, s.recordPath = nil, ""
+	return err
+}
+
+func (s *nativeServer) startRecording(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.startRecordingLocked(path)
+}
+
+func (s *nativeServer) stopRecording() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopRecordingLocked()
+}
@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// renderInterval coalesces output from the panes of a split window into at
+// most one composited frame per interval.
+const renderInterval = 16 * time.Millisecond
+
+// syncInterval is the shortest time between two frames sent to a client
+// in synchronized rendering mode.
+const syncInterval = 50 * time.Millisecond
+
+// Synchronized output (DEC mode 2026) makes the terminal show an update at
+// once instead of drawing it as it arrives. Terminals without it ignore the
+// sequences.
+const (
+	syncStart = "\x1b[?2026h"
+	syncEnd   = "\x1b[?2026l"
+)
+
+// Styles of the borders between panes and of the padding.
+const (
+	borderStyle       = "\x1b[90m"
+	activeBorderStyle = "\x1b[32m"
+)
+
+// paddingChar fills the part of a frame outside the session, when a
+// client's terminal is larger than the session.
+const paddingChar = "·"
+
+// scheduleRenderLocked arranges for the active window to be composited and
+// sent to the clients shortly: at the session size when it is split, and at
+// their own size to the framed clients, which either use synchronized
+// rendering or have a terminal that does not match the session. Framed
+// clients that still have a frame queued, or had a synchronized frame
+// within syncInterval, are rendered later; the frames in between are
+// never sent. s.mu must be held.
+func (s *nativeServer) scheduleRenderLocked() {
+	if s.renderPending {
+		return
+	}
+	s.renderPending = true
+	time.AfterFunc(renderInterval, s.render)
+}
+
+// render sends the frames arranged by scheduleRenderLocked. The layout of
+// the window is copied under s.mu and the panes are formatted and drawn
+// without it; a frame is only sent if nothing replaced the client's screen
+// in the meantime, otherwise it is rendered again.
+func (s *nativeServer) render() {
+	type job struct {
+		c        *serverClient
+		prev     *frame
+		viewport viewport
+	}
+
+	s.mu.Lock()
+	s.renderPending = false
+	w := s.activeWindowLocked()
+	if w == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.screens++
+	screens := s.screens
+	split := len(w.panes) > 1
+	wc := s.copyWindowLocked(w)
+	var jobs []job
+	again := false
+	for _, c := range s.clients {
+		if !c.framed {
+			continue
+		}
+		if len(c.queue) > 0 || (c.sync && time.Since(c.frameAt) < syncInterval) {
+			again = true
+			continue
+		}
+		jobs = append(jobs, job{c, c.frame, c.viewport})
+	}
+	s.mu.Unlock()
+
+	wc.format()
+	session := wc.view()
+	var output []byte
+	if split {
+		output = []byte(session.frame().render())
+	}
+	frames := make([]*frame, len(jobs))
+	updates := make([]string, len(jobs))
+	for i := range jobs {
+		j := &jobs[i]
+		frames[i] = session.crop(int(j.c.cols), int(j.c.rows), &j.viewport).frame()
+		updates[i] = frames[i].diff(j.prev)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A later render or redraw already replaced the screen of the clients
+	// that get the shared frame.
+	if split && s.screens == screens {
+		if s.recorder != nil {
+			_ = s.recorder.Output(output)
+		}
+		for _, c := range s.clients {
+			if !c.framed {
+				s.sendLocked(c, output)
+			}
+		}
+	}
+	for i, j := range jobs {
+		if !j.c.framed || j.c.frame != j.prev {
+			again = true
+			continue
+		}
+		if updates[i] != "" {
+			s.sendLocked(j.c, []byte(updates[i]))
+		}
+		j.c.frame, j.c.frameAt, j.c.viewport = frames[i], time.Now(), j.viewport
+	}
+	if again {
+		s.scheduleRenderLocked()
+	}
+}
+
+// windowCopy is the layout of a window copied under s.mu, so that its
+// panes can be formatted and composited without it.
+type windowCopy struct {
+	cols, rows int
+	borders    [][]cell // the borders between the panes, blank elsewhere
+	panes      []paneCopy
+}
+
+// paneCopy is where a pane sits in a windowCopy and, once formatted, the
+// VT snapshot of its terminal.
+type paneCopy struct {
+	pane             *serverPane
+	x, y, cols, rows int
+	active           bool
+	snapshot         string
+}
+
+// copyWindowLocked copies the layout of a window at the session size. s.mu
+// must be held.
+func (s *nativeServer) copyWindowLocked(w *serverWindow) *windowCopy {
+	wc := &windowCopy{cols: int(s.cols), rows: int(s.rows)}
+	wc.borders = blankCells(wc.cols, wc.rows)
+	w.root.drawBorders(wc.borders, w.activePane)
+	for _, p := range w.panes {
+		wc.panes = append(wc.panes, paneCopy{
+			pane: p,
+			x:    int(p.x), y: int(p.y), cols: int(p.cols), rows: int(p.rows),
+			active: p == w.activePane,
+		})
+	}
+	return wc
+}
+
+// format takes the VT snapshots of the panes from their terminals. Panes
+// that were closed meanwhile stay blank.
+func (wc *windowCopy) format() {
+	for i := range wc.panes {
+		wc.panes[i].snapshot, _ = wc.panes[i].pane.snapshot()
+	}
+}
+
+// view composites the formatted panes into a view of the session, with
+// the cursor of the active pane.
+func (wc *windowCopy) view() *view {
+	v := &view{cells: make([][]cell, len(wc.borders))}
+	for y, row := range wc.borders {
+		v.cells[y] = append([]cell(nil), row...)
+	}
+	for _, p := range wc.panes {
+		cells, x, y := decodeSnapshot(p.snapshot, p.cols, p.rows)
+		for r, row := range cells {
+			if p.y+r >= wc.rows {
+				break
+			}
+			copy(v.cells[p.y+r][p.x:min(p.x+p.cols, wc.cols)], row)
+		}
+		if p.active {
+			v.cursorX, v.cursorY = p.x+x, p.y+y
+		}
+	}
+	return v
+}
+
+// view is a window as a client of a given size sees it: the cells of its
+// panes and their borders.
+type view struct {
+	cells        [][]cell
+	cursorX      int
+	cursorY      int
+	cursorHidden bool
+}
+
+// viewport is the part of the session shown to a client whose terminal is
+// smaller than the session.
+type viewport struct {
+	x, y int
+}
+
+// follow moves the viewport of a view of cols by rows over a session of
+// sessionCols by sessionRows as little as it takes to show the cursor.
+func (vp *viewport) follow(cursorX, cursorY, cols, rows, sessionCols, sessionRows int) {
+	vp.x = followCursor(vp.x, cursorX, cols, sessionCols)
+	vp.y = followCursor(vp.y, cursorY, rows, sessionRows)
+}
+
+func followCursor(offset, cursor, size, sessionSize int) int {
+	offset = min(offset, cursor)
+	offset = max(offset, cursor-size+1)
+	return max(min(offset, sessionSize-size), 0)
+}
+
+// crop fits a view of the session into cols by rows. A larger view is
+// padded. A smaller one shows the part of the session in vp, which follows
+// the cursor; without vp it shows the top left corner.
+func (v *view) crop(cols, rows int, vp *viewport) *view {
+	sessionRows := len(v.cells)
+	sessionCols := 0
+	if sessionRows > 0 {
+		sessionCols = len(v.cells[0])
+	}
+	var offsetX, offsetY int
+	if vp != nil {
+		vp.follow(v.cursorX, v.cursorY, cols, rows, sessionCols, sessionRows)
+		offsetX, offsetY = vp.x, vp.y
+	}
+	out := &view{cells: make([][]cell, rows), cursorHidden: v.cursorHidden}
+	for y := range out.cells {
+		out.cells[y] = make([]cell, cols)
+		for x := range out.cells[y] {
+			sx, sy := x+offsetX, y+offsetY
+			if sx >= sessionCols || sy >= sessionRows {
+				out.cells[y][x] = cell{text: paddingChar, style: borderStyle}
+				continue
+			}
+			c := v.cells[sy][sx]
+			// Wide characters cut in half by the edges of the view are
+			// dropped.
+			if (x == 0 && c.text == "") || (x == cols-1 && sx+1 < sessionCols && v.cells[sy][sx+1].text == "") {
+				c = cell{text: " "}
+			}
+			out.cells[y][x] = c
+		}
+	}
+	out.cursorX, out.cursorY = v.cursorX-offsetX, v.cursorY-offsetY
+	if out.cursorX < 0 || out.cursorY < 0 || out.cursorX >= cols || out.cursorY >= rows {
+		out.cursorX, out.cursorY = max(min(out.cursorX, cols-1), 0), max(min(out.cursorY, rows-1), 0)
+		out.cursorHidden = true
+	}
+	return out
+}
+
+// frame is a drawn view: the sequences of each row and where the cursor
+// is.
+type frame struct {
+	rows             []string
+	cursorX, cursorY int
+	cursorHidden     bool
+}
+
+// frame draws the view.
+func (v *view) frame() *frame {
+	f := &frame{
+		rows:         make([]string, len(v.cells)),
+		cursorX:      v.cursorX,
+		cursorY:      v.cursorY,
+		cursorHidden: v.cursorHidden,
+	}
+	for y, row := range v.cells {
+		f.rows[y] = renderRow(row)
+	}
+	return f
+}
+
+// render draws the whole frame, resetting the modes output from the
+// panes may have left the terminal in.
+func (f *frame) render() string {
+	var b strings.Builder
+	b.WriteString("\x1b[?25l\x1b[0m\x1b[r\x1b[?6l\x1b[?7h\x1b[4l")
+	for y, row := range f.rows {
+		fmt.Fprintf(&b, "\x1b[%d;1H%s", y+1, row)
+	}
+	b.WriteString(f.cursor())
+	return b.String()
+}
+
+// cursor places the cursor and shows it unless it is outside the view.
+func (f *frame) cursor() string {
+	s := fmt.Sprintf("\x1b[%d;%dH", f.cursorY+1, f.cursorX+1)
+	if !f.cursorHidden {
+		s += "\x1b[?25h"
+	}
+	return s
+}
+
+// diff draws the rows that changed since prev, which the terminal is
+// showing, or the whole frame without prev, as one synchronized update. It
+// returns "" when nothing changed.
+func (f *frame) diff(prev *frame) string {
+	if prev == nil || len(prev.rows) != len(f.rows) {
+		return syncStart + f.render() + syncEnd
+	}
+	var b strings.Builder
+	for y, row := range f.rows {
+		if row != prev.rows[y] {
+			fmt.Fprintf(&b, "\x1b[%d;1H%s", y+1, row)
+		}
+	}
+	if b.Len() == 0 && f.cursorX == prev.cursorX && f.cursorY == prev.cursorY && f.cursorHidden == prev.cursorHidden {
+		return ""
+	}
+	return syncStart + "\x1b[?25l\x1b[0m" + b.String() + f.cursor() + syncEnd
+}
+
+// viewLocked composites a window into a view of viewCols by viewRows, see
+// view and crop. s.mu must be held.
+func (s *nativeServer) viewLocked(w *serverWindow, viewCols, viewRows uint16, vp *viewport) *view {
+	wc := s.copyWindowLocked(w)
+	wc.format()
+	return wc.view().crop(int(viewCols), int(viewRows), vp)
+}
+
+// composeLocked renders a window into a single frame of frameCols by
+// frameRows, see viewLocked. s.mu must be held.
+func (s *nativeServer) composeLocked(w *serverWindow, frameCols, frameRows uint16) string {
+	return s.viewLocked(w, frameCols, frameRows, nil).frame().render()
+}
+
+// drawBorders draws the separator of every split below n into cells.
+func (n *layoutNode) drawBorders(cells [][]cell, active *serverPane) {
+	if n.pane != nil {
+		return
+	}
+	if n.vertical {
+		y := int(n.children[1].y) - 1
+		for x := int(n.x); x < int(n.x+n.cols); x++ {
+			setBorder(cells, x, y, '─', active)
+		}
+	} else {
+		x := int(n.children[1].x) - 1
+		for y := int(n.y); y < int(n.y+n.rows); y++ {
+			setBorder(cells, x, y, '│', active)
+		}
+	}
+	n.children[0].drawBorders(cells, active)
+	n.children[1].drawBorders(cells, active)
+}
+
+func setBorder(cells [][]cell, x, y int, ch rune, active *serverPane) {
+	if y < 0 || y >= len(cells) || x < 0 || x >= len(cells[y]) {
+		return
+	}
+	c := &cells[y][x]
+	border := c.style == borderStyle || c.style == activeBorderStyle
+	if border && c.text != string(ch) {
+		ch = '┼'
+	}
+	highlight := c.style == activeBorderStyle
+	if active != nil {
+		ax, ay := int(active.x), int(active.y)
+		highlight = highlight || (x >= ax-1 && x <= ax+int(active.cols) && y >= ay-1 && y <= ay+int(active.rows))
+	}
+	c.text, c.style = string(ch), borderStyle
+	if highlight {
+		c.style = activeBorderStyle
+	}
+}
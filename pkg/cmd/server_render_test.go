@@ -0,0 +1,65 @@
+package cmd
+
+import "testing"
+
+func TestFrameDiff(t *testing.T) {
+	prev := &frame{rows: []string{"$ ls", "a b", "$ "}, cursorX: 2, cursorY: 2}
+
+	if got := (&frame{rows: prev.rows, cursorX: 2, cursorY: 2}).diff(prev); got != "" {
+		t.Errorf("unchanged frame: diff %q; want nothing", got)
+	}
+
+	next := &frame{rows: []string{"$ ls", "a b", "$ x"}, cursorX: 3, cursorY: 2}
+	want := syncStart + "\x1b[?25l\x1b[0m\x1b[3;1H$ x\x1b[3;4H\x1b[?25h" + syncEnd
+	if got := next.diff(prev); got != want {
+		t.Errorf("diff = %q; want %q", got, want)
+	}
+
+	if got, want := next.diff(nil), syncStart+next.render()+syncEnd; got != want {
+		t.Errorf("diff without a previous frame = %q; want the whole frame %q", got, want)
+	}
+}
+
+func TestWindowView(t *testing.T) {
+	left := &serverPane{cols: 4, rows: 2}
+	right := &serverPane{x: 5, cols: 4, rows: 2}
+	root := &layoutNode{cols: 9, rows: 2}
+	root.split(left, false)
+	root.children[0].pane, root.children[1].pane = left, right
+	root.children[1].x = 5
+	w := &serverWindow{root: root, panes: []*serverPane{left, right}, activePane: right}
+	s := &nativeServer{cols: 9, rows: 2}
+
+	wc := s.copyWindowLocked(w)
+	wc.panes[0].snapshot = "\x1b[31mab"
+	wc.panes[1].snapshot = "cd"
+	session := wc.view()
+	f := session.frame()
+	if want := "\x1b[0m\x1b[31mab\x1b[0m  \x1b[0m\x1b[32m│\x1b[0mcd\x1b[K"; f.rows[0] != want {
+		t.Errorf("row = %q; want %q", f.rows[0], want)
+	}
+	if f.cursorX != 7 || f.cursorY != 0 {
+		t.Errorf("cursor = %d,%d; want the right pane's cursor at 7,0", f.cursorX, f.cursorY)
+	}
+
+	// A larger client gets the session padded, a smaller one the part
+	// around the cursor.
+	f = session.crop(10, 3, &viewport{}).frame()
+	if want := "\x1b[0m\x1b[90m··········\x1b[0m"; f.rows[2] != want {
+		t.Errorf("padding row = %q; want %q", f.rows[2], want)
+	}
+	vp := &viewport{}
+	f = session.crop(3, 1, vp).frame()
+	if want := "cd\x1b[K"; len(f.rows) != 1 || f.rows[0] != want {
+		t.Errorf("cropped rows = %q; want [%q]", f.rows, want)
+	}
+	if f.cursorX != 2 || f.cursorY != 0 || f.cursorHidden {
+		t.Errorf("cropped cursor = %d,%d hidden %v; want 2,0 shown", f.cursorX, f.cursorY, f.cursorHidden)
+	}
+
+	// The viewport only moves when the cursor leaves it.
+	wc.panes[1].snapshot = "cd\b\b"
+	if f = wc.view().crop(3, 1, vp).frame(); vp.x != 5 || f.cursorX != 0 {
+		t.Errorf("viewport at %d, cursor at %d; want 5 and 0", vp.x, f.cursorX)
+	}
+}
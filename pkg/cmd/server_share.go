@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+// peer describes who is on the other end of a connection.
+type peer struct {
+	uid      int
+	pid      int
+	guest    bool // another user connecting through the shared socket
+	readOnly bool // the ACL only grants read access
+}
+
+// ownerOnlyCommands are the commands guests may not run even with read-write
+// access: those that manage the session's access and clients, and the
+// recording, which writes files as the owner.
+var ownerOnlyCommands = map[string]bool{
+	"share":          true,
+	"unshare":        true,
+	"list-shares":    true,
+	"rename-session": true,
+	"kick-client":    true,
+	"detach-client":  true,
+	"record-start":   true,
+	"record-stop":    true,
+}
+
+// acceptShared serves connections on the shared socket, admitting only the
+// owner and the users in the ACL.
+func (s *nativeServer) acceptShared(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			fc := backend.NewFrameConn(conn)
+			cred, err := backend.PeerCred(conn)
+			if err != nil {
+				_ = fc.Close()
+				return
+			}
+			p := peer{uid: cred.UID, pid: cred.PID, guest: cred.UID != os.Getuid()}
+			if p.guest {
+				s.mu.Lock()
+				readOnly, ok := s.acl[cred.UID]
+				s.mu.Unlock()
+				if !ok {
+					// Probes that hang up before the handshake, such as
+					// liveness checks, are not worth an audit entry.
+					if _, err := fc.ServerHello(); err == nil {
+						_ = fc.WriteFrame(backend.MsgError, []byte("session is not shared with you"))
+						s.mu.Lock()
+						s.auditLocked("denied uid=%d pid=%d", cred.UID, cred.PID)
+						s.mu.Unlock()
+					}
+					_ = fc.Close()
+					return
+				}
+				p.readOnly = readOnly
+			}
+			s.handleConn(fc, p)
+		}()
+	}
+}
+
+// share grants a user access to the session, opening the shared socket on
+// the first share. Clients the user already has attached are disconnected
+// so they reconnect with the new access mode.
+func (s *nativeServer) share(userName, mode string) error {
+	var readOnly bool
+	switch mode {
+	case "ro":
+		readOnly = true
+	case "rw":
+	default:
+		return fmt.Errorf("invalid access mode %q", mode)
+	}
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return fmt.Errorf("unknown user %s", userName)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("user %s has no numeric uid", userName)
+	}
+	if uid == os.Getuid() {
+		return fmt.Errorf("the session already belongs to %s", userName)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sharedListener == nil {
+		if err := s.listenSharedLocked(); err != nil {
+			return err
+		}
+	}
+	if s.acl == nil {
+		s.acl = make(map[int]bool)
+	}
+	if old, ok := s.acl[uid]; ok && old != readOnly {
+		s.dropGuestLocked(uid)
+	}
+	s.acl[uid] = readOnly
+	s.auditLocked("share user=%s uid=%d mode=%s", userName, uid, mode)
+	return nil
+}
+
+// unshare revokes a user's access and disconnects their clients. The
+// shared socket is closed once nobody is left in the ACL.
+func (s *nativeServer) unshare(userName string) error {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return fmt.Errorf("unknown user %s", userName)
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.acl[uid]; !ok {
+		return fmt.Errorf("session is not shared with %s", userName)
+	}
+	delete(s.acl, uid)
+	s.dropGuestLocked(uid)
+	s.auditLocked("unshare user=%s uid=%d", userName, uid)
+
+	if len(s.acl) == 0 && s.sharedListener != nil {
+		_ = s.sharedListener.Close()
+		_ = os.Remove(s.sharedPath)
+		s.sharedListener, s.sharedPath = nil, ""
+	}
+	return nil
+}
+
+// listShares describes the ACL, sorted by user name.
+func (s *nativeServer) listShares() []backend.ShareInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shares := make([]backend.ShareInfo, 0, len(s.acl))
+	for uid, readOnly := range s.acl {
+		name := strconv.Itoa(uid)
+		if u, err := user.LookupId(name); err == nil {
+			name = u.Username
+		}
+		shares = append(shares, backend.ShareInfo{User: name, UID: uid, ReadOnly: readOnly})
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].User < shares[j].User })
+	return shares
+}
+
+// listenSharedLocked opens the shared socket. It belongs to shareGroup, or
+// the owner's primary group, and only the owner and that group may connect
+// to it; acceptShared decides who of them gets in. s.mu must be held.
+func (s *nativeServer) listenSharedLocked() error {
+	gid := os.Getgid()
+	if s.shareGroup != "" {
+		g, err := user.LookupGroup(s.shareGroup)
+		if err != nil {
+			return fmt.Errorf("unknown share group %s", s.shareGroup)
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return fmt.Errorf("share group %s has no numeric gid", s.shareGroup)
+		}
+	}
+	path, err := backend.SharedSocketPath(s.name)
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to open shared socket: %v", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chown(path, -1, gid); err != nil {
+		_ = listener.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to give the shared socket to group %d: %v", gid, err)
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		_ = listener.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	s.sharedListener, s.sharedPath = listener, path
+	go s.acceptShared(listener)
+	return nil
+}
+
+// dropGuestLocked disconnects every client attached by uid. s.mu must be
+// held.
+func (s *nativeServer) dropGuestLocked(uid int) {
+	for _, c := range s.clients {
+		if c.guest && c.uid == uid {
+			c.detachLocked("")
+		}
+	}
+}
+
+// auditLocked appends a line about a shared session event to the owner's
+// audit log. s.mu must be held.
+func (s *nativeServer) auditLocked(format string, args ...interface{}) {
+	path, err := backend.AuditLogPath()
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	line := fmt.Sprintf(format, args...)
+	_, _ = fmt.Fprintf(f, "%s session=%s %s\n", time.Now().Format(time.RFC3339), s.name, line)
+}
+
+// renameSharedLocked moves the shared socket along with a session rename.
+// s.mu must be held.
+func (s *nativeServer) renameSharedLocked(newName string) {
+	if s.sharedPath == "" {
+		return
+	}
+	newPath := filepath.Join(filepath.Dir(s.sharedPath), newName+".sock")
+	if err := os.Rename(s.sharedPath, newPath); err == nil {
+		s.sharedPath = newPath
+	}
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"github.com/MohamedElashri/txm/pkg/config"
+)
+
+// resizeClient records the terminal size of a client and resizes the
+// session as its size policy demands.
+func (s *nativeServer) resizeClient(c *serverClient, cols, rows uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.cols, c.rows = cols, rows
+	// Read-only clients only watch, so they never change the session size.
+	if !c.readOnly {
+		s.sizeClient = c
+	}
+	s.applySizeLocked()
+}
+
+// setSizePolicy changes the size policy of the session and returns the
+// policy in effect; an empty policy only returns it.
+func (s *nativeServer) setSizePolicy(policy string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if policy != "" {
+		policy, err := config.ParseSizePolicy(policy)
+		if err != nil {
+			return "", err
+		}
+		s.sizePolicy = policy
+		s.applySizeLocked()
+	}
+	return s.sizePolicy, nil
+}
+
+// sessionSizeLocked computes the session size from the size policy and
+// the sizes the read-write clients reported. It keeps the current size
+// when no client reported one. s.mu must be held.
+func (s *nativeServer) sessionSizeLocked() (uint16, uint16) {
+	if cols, rows, ok := config.FixedSize(s.sizePolicy); ok {
+		return cols, rows
+	}
+	cols, rows := s.cols, s.rows
+	switch s.sizePolicy {
+	case "smallest", "largest":
+		sized := false
+		for _, c := range s.clients {
+			if c.readOnly || c.cols == 0 {
+				continue
+			}
+			if !sized {
+				cols, rows, sized = c.cols, c.rows, true
+			} else if s.sizePolicy == "smallest" {
+				cols, rows = min(cols, c.cols), min(rows, c.rows)
+			} else {
+				cols, rows = max(cols, c.cols), max(rows, c.rows)
+			}
+		}
+	default:
+		if c := s.sizeClient; c != nil {
+			cols, rows = c.cols, c.rows
+		}
+	}
+	return cols, rows
+}
+
+// applySizeLocked resizes every window to the size the policy gives and
+// switches the clients whose terminal does not match it to rendered frames,
+// padded to their own size or cropped around the cursor, as well as the
+// clients that use synchronized rendering. Clients that match again get
+// their screen redrawn from the live stream. s.mu must be held.
+func (s *nativeServer) applySizeLocked() {
+	cols, rows := s.sessionSizeLocked()
+	if cols != s.cols || rows != s.rows {
+		if s.recorder != nil {
+			_ = s.recorder.Resize(int(cols), int(rows))
+		}
+		s.cols, s.rows = cols, rows
+		for _, w := range s.windows {
+			w.layout(cols, rows)
+		}
+		if w := s.activeWindowLocked(); w != nil && len(w.panes) > 1 {
+			s.redrawLocked()
+		}
+	}
+
+	for _, c := range s.clients {
+		framed := c.cols != 0 && (c.sync || c.cols != s.cols || c.rows != s.rows)
+		if framed {
+			s.scheduleRenderLocked()
+		}
+		if framed == c.framed {
+			continue
+		}
+		c.framed = framed
+		c.frame = nil
+		if !framed {
+			s.sendLocked(c, []byte(s.clientScreenLocked(c)))
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import "testing"
+
+func TestSessionSize(t *testing.T) {
+	big := &serverClient{cols: 120, rows: 30}
+	small := &serverClient{cols: 80, rows: 40}
+	watcher := &serverClient{cols: 40, rows: 10, readOnly: true}
+	unsized := &serverClient{}
+
+	tests := []struct {
+		policy     string
+		cols, rows uint16
+	}{
+		{"smallest", 80, 30},
+		{"largest", 120, 40},
+		{"latest", 80, 40},
+		{"100x50", 100, 50},
+	}
+	for _, tt := range tests {
+		s := &nativeServer{
+			sizePolicy: tt.policy,
+			cols:       90,
+			rows:       20,
+			clients:    []*serverClient{big, small, watcher, unsized},
+			sizeClient: small,
+		}
+		if cols, rows := s.sessionSizeLocked(); cols != tt.cols || rows != tt.rows {
+			t.Errorf("%s: size %dx%d; want %dx%d", tt.policy, cols, rows, tt.cols, tt.rows)
+		}
+	}
+
+	s := &nativeServer{sizePolicy: "smallest", cols: 90, rows: 20, clients: []*serverClient{watcher, unsized}}
+	if cols, rows := s.sessionSizeLocked(); cols != 90 || rows != 20 {
+		t.Errorf("without sized clients: size %dx%d; want 90x20", cols, rows)
+	}
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// cell is one character cell of a view. Wide characters occupy their first
+// cell; the cell after them holds an empty string. style holds the SGR
+// sequences in effect since the last reset.
+type cell struct {
+	text  string
+	style string
+}
+
+// blankCells returns cols by rows blank cells.
+func blankCells(cols, rows int) [][]cell {
+	cells := make([][]cell, rows)
+	for y := range cells {
+		cells[y] = make([]cell, cols)
+		for x := range cells[y] {
+			cells[y][x] = cell{text: " "}
+		}
+	}
+	return cells
+}
+
+// decodeSnapshot lays out the VT snapshot of a pane of cols by rows the way
+// an attaching client's terminal of that size draws it from the top left
+// corner: text with its colors and attributes, wrapped at the right edge,
+// scrolled up once it runs past the last row. It returns the visible cells
+// and where the snapshot leaves the cursor. Sequences other than SGR and
+// cursor positioning do not change cells and are skipped.
+func decodeSnapshot(snapshot string, cols, rows int) ([][]cell, int, int) {
+	if cols <= 0 || rows <= 0 {
+		return nil, 0, 0
+	}
+	lines := blankCells(cols, 1)
+	x, y, style := 0, 0, ""
+	newline := func() {
+		x, y = 0, y+1
+		for y >= len(lines) {
+			lines = append(lines, blankCells(cols, 1)...)
+		}
+	}
+	for i := 0; i < len(snapshot); {
+		b := snapshot[i]
+		switch {
+		case b == '\x1b':
+			var final byte
+			var params string
+			final, params, i = scanEscape(snapshot, i)
+			switch final {
+			case 'm':
+				style = applySGR(style, params)
+			case 'H', 'f':
+				row, col, _ := strings.Cut(params, ";")
+				top := max(len(lines)-rows, 0)
+				x = min(max(atoiDefault(col, 1), 1), cols) - 1
+				y = top + min(max(atoiDefault(row, 1), 1), rows) - 1
+				for y >= len(lines) {
+					lines = append(lines, blankCells(cols, 1)...)
+				}
+			}
+			continue
+		case b == '\r':
+			x = 0
+		case b == '\n':
+			newline()
+		case b == '\b':
+			x = max(x-1, 0)
+		case b == '\t':
+			x = min((x/8+1)*8, cols-1)
+		case b < 0x20 || b == 0x7f:
+		default:
+			r, size := utf8.DecodeRuneInString(snapshot[i:])
+			i += size
+			width := runewidth.RuneWidth(r)
+			if width == 0 {
+				// Combining characters join the character before them.
+				if px := x - 1; px >= 0 {
+					if lines[y][px].text == "" && px > 0 {
+						px--
+					}
+					lines[y][px].text += string(r)
+				}
+				continue
+			}
+			if width > cols {
+				continue
+			}
+			if x+width > cols {
+				newline()
+			}
+			lines[y][x] = cell{text: string(r), style: style}
+			if width == 2 {
+				lines[y][x+1] = cell{style: style}
+			}
+			x += width
+			continue
+		}
+		i++
+	}
+
+	if len(lines) > rows {
+		y -= len(lines) - rows
+		lines = lines[len(lines)-rows:]
+	}
+	for len(lines) < rows {
+		lines = append(lines, blankCells(cols, 1)...)
+	}
+	return lines, min(x, cols-1), y
+}
+
+// scanEscape reads the escape sequence starting at s[i]. It returns the
+// final byte and parameters of a CSI sequence, or 0 for any other
+// sequence, and the index after it.
+func scanEscape(s string, i int) (byte, string, int) {
+	if i+1 >= len(s) {
+		return 0, "", len(s)
+	}
+	switch s[i+1] {
+	case '[':
+		for j := i + 2; j < len(s); j++ {
+			if s[j] >= 0x40 && s[j] <= 0x7e {
+				return s[j], s[i+2 : j], j + 1
+			}
+		}
+		return 0, "", len(s)
+	case ']', 'P', '_', '^':
+		// OSC and other strings end with BEL or ST.
+		for j := i + 2; j < len(s); j++ {
+			if s[j] == '\a' {
+				return 0, "", j + 1
+			}
+			if s[j] == '\x1b' && j+1 < len(s) && s[j+1] == '\\' {
+				return 0, "", j + 2
+			}
+		}
+		return 0, "", len(s)
+	case '(', ')', '*', '+', '#', '%':
+		return 0, "", min(i+3, len(s))
+	}
+	return 0, "", i + 2
+}
+
+// applySGR returns the style after an SGR sequence with the given
+// parameters.
+func applySGR(style, params string) string {
+	first, rest, _ := strings.Cut(params, ";")
+	if first == "" || first == "0" {
+		style = ""
+		if rest == "" {
+			return style
+		}
+		params = rest
+	}
+	return style + "\x1b[" + params + "m"
+}
+
+func atoiDefault(s string, def int) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// renderRow draws a row of cells from the cursor, which must be at its
+// start, in the default style. The style is back to the default afterwards.
+// Blanks at the end of the row are erased rather than drawn.
+func renderRow(cells []cell) string {
+	end := len(cells)
+	for end > 0 && cells[end-1] == (cell{text: " "}) {
+		end--
+	}
+	var b strings.Builder
+	style := ""
+	for _, c := range cells[:end] {
+		if c.text == "" {
+			continue
+		}
+		if c.style != style {
+			b.WriteString("\x1b[0m" + c.style)
+			style = c.style
+		}
+		b.WriteString(c.text)
+	}
+	if style != "" {
+		b.WriteString("\x1b[0m")
+	}
+	if end < len(cells) {
+		b.WriteString("\x1b[K")
+	}
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func cellText(cells [][]cell) []string {
+	var lines []string
+	for _, row := range cells {
+		line := ""
+		for _, c := range row {
+			line += c.text
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestDecodeSnapshot(t *testing.T) {
+	cells, x, y := decodeSnapshot("hello\r\n\x1b[1;31mred\x1b[0m wide:世\x1b]0;title\a", 10, 3)
+	if got, want := cellText(cells), []string{"hello     ", "red wide: ", "世        "}; !slices.Equal(got, want) {
+		t.Errorf("lines = %q; want %q", got, want)
+	}
+	if got := cells[1][0].style; got != "\x1b[1;31m" {
+		t.Errorf("style of a red cell = %q", got)
+	}
+	if got := cells[1][3].style; got != "" {
+		t.Errorf("style after a reset = %q", got)
+	}
+	if x != 2 || y != 2 {
+		t.Errorf("cursor = %d,%d; want 2,2 after the wide character", x, y)
+	}
+
+	// Like a terminal of the pane's size, the snapshot scrolls once it is
+	// longer than the pane, and cursor positions are relative to what is
+	// visible.
+	cells, x, y = decodeSnapshot("1\r\n2\r\n3\r\n4\x1b[1;2H", 3, 2)
+	if got, want := cellText(cells), []string{"3  ", "4  "}; !slices.Equal(got, want) {
+		t.Errorf("lines = %q; want %q", got, want)
+	}
+	if x != 1 || y != 0 {
+		t.Errorf("cursor = %d,%d; want 1,0", x, y)
+	}
+}
+
+func TestRenderRow(t *testing.T) {
+	row := []cell{{"a", "\x1b[1m"}, {"b", "\x1b[1m"}, {"世", ""}, {"", ""}, {" ", ""}}
+	if got, want := renderRow(row), "\x1b[0m\x1b[1mab\x1b[0m世\x1b[K"; got != want {
+		t.Errorf("renderRow = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// foregroundProcess returns the name of the process group in the foreground
+// of a PTY, which is what the user is running in the pane right now.
+func foregroundProcess(ptmx *os.File) string {
+	raw, err := ptmx.SyscallConn()
+	if err != nil {
+		return ""
+	}
+	pgid := -1
+	_ = raw.Control(func(fd uintptr) {
+		if id, err := unix.IoctlGetInt(int(fd), unix.TIOCGPGRP); err == nil {
+			pgid = id
+		}
+	})
+	if pgid <= 0 {
+		return ""
+	}
+
+	if runtime.GOOS == "linux" {
+		comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pgid))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(comm))
+	}
+	out, err := exec.Command("ps", "-o", "comm=", "-p", fmt.Sprint(pgid)).Output()
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(strings.TrimSpace(string(out)))
+}
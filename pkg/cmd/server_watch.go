@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+// watchInterval is the minimum time between two states sent to a watcher,
+// so that a burst of output is sent as one state.
+const watchInterval = 100 * time.Millisecond
+
+// watchPane streams the state of a pane to a connection that sent MsgWatch,
+// until the pane's process exits or the connection is closed.
+func (s *nativeServer) watchPane(c *backend.FrameConn, payload []byte) {
+	var watch backend.Watch
+	if err := json.Unmarshal(payload, &watch); err != nil {
+		_ = c.WriteFrame(backend.MsgError, []byte("malformed watch request: "+err.Error()))
+		return
+	}
+
+	notify := make(chan struct{}, 1)
+	s.mu.Lock()
+	p, err := s.findPaneLocked(watch.Window, watch.Pane)
+	if err == nil {
+		p.watchers = append(p.watchers, notify)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		_ = c.WriteFrame(backend.MsgError, []byte(err.Error()))
+		return
+	}
+	defer func() {
+		s.mu.Lock()
+		for i, w := range p.watchers {
+			if w == notify {
+				p.watchers = append(p.watchers[:i], p.watchers[i+1:]...)
+				break
+			}
+		}
+		s.mu.Unlock()
+	}()
+
+	// The watcher sends nothing more, so reading only notices it hang up.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := c.ReadFrame(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		st := s.paneState(p)
+		data, _ := json.Marshal(st)
+		if err := c.WriteFrame(backend.MsgWatch, data); err != nil || st.Exited {
+			return
+		}
+		select {
+		case <-notify:
+		case <-gone:
+			return
+		}
+		select {
+		case <-time.After(watchInterval):
+		case <-gone:
+			return
+		}
+	}
+}
+
+// notifyWatchersLocked tells the connections watching a pane that its
+// state changed. s.mu must be held.
+func (p *serverPane) notifyWatchersLocked() {
+	for _, w := range p.watchers {
+		select {
+		case w <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// paneState describes a pane to its watchers. A pane that was removed
+// reports its process as exited, with its exit status once readPane has
+// recorded it, and the screen it had when it was removed, so that output
+// right before the exit is not missed.
+func (s *nativeServer) paneState(p *serverPane) backend.PaneState {
+	s.mu.Lock()
+	rows, dead, exitStatus := int(p.rows), p.dead, p.exitStatus
+	s.mu.Unlock()
+
+	screen, err := p.screenText(rows)
+	if err != nil {
+		// The terminal is closed only after removePaneLocked recorded the
+		// final screen.
+		s.mu.Lock()
+		screen, exitStatus = p.finalScreen, p.exitStatus
+		s.mu.Unlock()
+	}
+	st := backend.PaneState{Screen: screen, Exited: dead || err != nil}
+	if st.Exited {
+		st.ExitStatus = exitStatus
+	}
+	return st
+}
+
+// screenLines returns the last rows lines of a plain text rendering, which
+// is the visible screen; everything before it is scrollback.
+func screenLines(text string, rows int) []string {
+	text = strings.TrimSuffix(text, "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	if len(lines) > rows {
+		lines = lines[len(lines)-rows:]
+	}
+	return lines
+}
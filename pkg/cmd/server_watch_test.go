@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+func TestWatchPaneOutputBeforeExit(t *testing.T) {
+	s := &nativeServer{cols: 80, rows: 24}
+	// A second window keeps the session alive when the watched pane exits.
+	if _, err := s.newWindow("idle", []string{"sleep", "60"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		// remain-on-exit keeps the last pane around when it is killed.
+		s.mu.Lock()
+		s.remainOnExit = true
+		s.windows[0].panes[0].kill()
+		s.mu.Unlock()
+	}()
+	w, err := s.newWindow("exit", []string{"sh", "-c", "read x; printf match"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := w.panes[0]
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go s.watchPane(backend.NewFrameConn(server), []byte(`{"window":"exit"}`))
+	fc := backend.NewFrameConn(client)
+	readState := func() backend.PaneState {
+		typ, data, err := fc.ReadFrame()
+		if err != nil || typ != backend.MsgWatch {
+			t.Fatalf("watch frame = 0x%02x %q, %v", typ, data, err)
+		}
+		var st backend.PaneState
+		if err := json.Unmarshal(data, &st); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	// The pane prints and exits at once, within one watch interval.
+	readState()
+	if _, err := p.ptmx.Write([]byte("\n")); err != nil {
+		t.Fatal(err)
+	}
+	st := readState()
+	for !st.Exited {
+		st = readState()
+	}
+	s.mu.Lock()
+	final := p.finalScreen
+	s.mu.Unlock()
+	if st.Screen != final || st.ExitStatus == "" {
+		t.Errorf("exited state = %+v; want the final screen %q and an exit status", st, final)
+	}
+}
@@ -0,0 +1,776 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/creack/pty"
+	"go.mitchellh.com/libghostty"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+// serverWindow is one window of a native session. It is split into one or
+// more panes arranged by a layout tree.
+type serverWindow struct {
+	id         int
+	name       string
+	root       *layoutNode
+	panes      []*serverPane
+	activePane *serverPane
+	nextPaneID int
+}
+
+// serverPane is a child process on its own PTY together with the libghostty
+// terminal that tracks its screen and scrollback.
+type serverPane struct {
+	id     int
+	window *serverWindow
+	cmd    *exec.Cmd
+	ptmx   *os.File
+
+	// dead is set once the process has exited and the pane is kept for
+	// remain-on-exit; killed marks panes whose process txm terminated,
+	// which are removed instead. exitStatus describes how the process
+	// exited, once readPane has waited for it. All are guarded by s.mu.
+	dead       bool
+	killed     bool
+	exitStatus string
+
+	// finalScreen is the text of the visible screen when the pane was
+	// removed, which paneState reports once the terminal is closed.
+	// Guarded by s.mu.
+	finalScreen string
+
+	// Position and size inside the window, assigned by layoutNode.layout.
+	x, y, cols, rows uint16
+
+	// termMu guards term, which libghostty does not synchronize itself.
+	// Output is written to term with s.mu held as well, see readPane.
+	termMu sync.Mutex
+	term   *libghostty.Terminal
+
+	// logPending is set when the pane had output since plain logging last
+	// looked at it, guarded by s.mu. logCount and logTail locate the lines
+	// already logged, and logErased holds the lines of an erased screen
+	// that were logged before the erase, guarded by s.logMu.
+	logPending bool
+	logCount   int
+	logTail    []string
+	logErased  []string
+
+	// watchers are notified of output and exit, see watchPane. Guarded by
+	// s.mu.
+	watchers []chan struct{}
+}
+
+// layoutNode is either a leaf holding a pane or a split with two children.
+type layoutNode struct {
+	parent *layoutNode
+	pane   *serverPane
+
+	// vertical splits stack their children top and bottom, horizontal
+	// splits place them side by side.
+	vertical bool
+	children [2]*layoutNode
+
+	// Rectangle covered by the node, assigned by layout.
+	x, y, cols, rows uint16
+}
+
+// newWindow starts argv (or the user's shell) in a new window, makes it the
+// active window and returns it.
+func (s *nativeServer) newWindow(name string, argv []string) (*serverWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := &serverWindow{id: s.nextWindowID}
+	p, err := s.startPaneLocked(w, argv, s.cols, s.rows)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = filepath.Base(p.cmd.Path)
+	}
+	w.name = name
+	w.root = &layoutNode{pane: p}
+	w.activePane = p
+	w.layout(s.cols, s.rows)
+
+	s.nextWindowID++
+	s.windows = append(s.windows, w)
+	s.active = len(s.windows) - 1
+	if len(s.windows) > 1 {
+		s.redrawLocked()
+	}
+
+	go s.readPane(p)
+	return w, nil
+}
+
+// startPaneLocked starts argv (or the user's shell) on a new PTY of the
+// given size and registers the pane with its window. The caller places the
+// pane in the window's layout and starts readPane. s.mu must be held.
+func (s *nativeServer) startPaneLocked(w *serverWindow, argv []string, cols, rows uint16) (*serverPane, error) {
+	var shellCmd *exec.Cmd
+	if len(argv) > 0 {
+		shellCmd = exec.Command(argv[0], argv[1:]...)
+	} else {
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "bash"
+		}
+		shellCmd = exec.Command(shell)
+		if s.spawn.Login {
+			// A dash in front of its name makes the shell a login shell.
+			shellCmd.Args[0] = "-" + filepath.Base(shell)
+		}
+	}
+	shellCmd.Dir = s.spawn.Dir
+	shellCmd.Env = s.childEnvLocked()
+
+	term, err := libghostty.NewTerminal(
+		libghostty.WithSize(cols, rows),
+		libghostty.WithMaxScrollback(uint(s.scrollbackSize)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create libghostty terminal: %v", err)
+	}
+
+	ptmx, err := pty.StartWithSize(shellCmd, &pty.Winsize{Cols: cols, Rows: rows})
+	if err != nil {
+		term.Close()
+		return nil, err
+	}
+
+	p := &serverPane{
+		id:     w.nextPaneID,
+		window: w,
+		cmd:    shellCmd,
+		ptmx:   ptmx,
+		cols:   cols,
+		rows:   rows,
+		term:   term,
+	}
+	w.nextPaneID++
+	w.panes = append(w.panes, p)
+	return p, nil
+}
+
+// readPane feeds the pane's PTY output into its terminal and, while its
+// window is active, to the attached clients, until the child process exits.
+// Each chunk is written to the terminal and queued for the clients under
+// one hold of s.mu, so a snapshot taken under s.mu is followed by exactly
+// the output after it.
+func (s *nativeServer) readPane(p *serverPane) {
+	ptmx, cmd := p.ptmx, p.cmd
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := ptmx.Read(buf)
+		if err != nil {
+			break
+		}
+
+		if s.logWriter != nil && !s.plainLog {
+			_, _ = s.logWriter.Write(buf[:n])
+		}
+
+		s.mu.Lock()
+		s.writePaneLocked(p, buf[:n])
+		s.outputs++
+		p.logPending = true
+		p.notifyWatchersLocked()
+		s.paneOutputLocked(p, buf[:n])
+		s.mu.Unlock()
+	}
+
+	_ = cmd.Wait()
+	s.paneExited(p)
+}
+
+// writePaneLocked writes output of a pane to its terminal. In plain log
+// mode the lines on the screen are logged before a sequence in the output
+// erases them, since they would never scroll off. s.mu must be held.
+func (s *nativeServer) writePaneLocked(p *serverPane, data []byte) {
+	for s.plainLog {
+		i, n := eraseIndex(data)
+		if i < 0 {
+			break
+		}
+		p.write(data[:i])
+		s.logScreenLines(p, int(p.rows))
+		p.write(data[i : i+n])
+		data = data[i+n:]
+	}
+	p.write(data)
+}
+
+// paneOutputLocked shows output of a pane to the clients when its window is
+// active. s.mu must be held.
+func (s *nativeServer) paneOutputLocked(p *serverPane, data []byte) {
+	if s.activeWindowLocked() != p.window {
+		return
+	}
+	if len(p.window.panes) == 1 {
+		s.broadcastLocked(data)
+	} else {
+		s.scheduleRenderLocked()
+	}
+}
+
+// paneExited removes a pane whose process has exited or, with
+// remain-on-exit, keeps it with its final screen and records the exit
+// status until it is respawned or killed.
+func (s *nativeServer) paneExited(p *serverPane) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.exitStatus = p.cmd.ProcessState.String()
+	if !s.remainOnExit || p.killed {
+		s.removePaneLocked(p)
+		return
+	}
+
+	_ = p.ptmx.Close()
+	p.dead = true
+	msg := []byte(fmt.Sprintf("\r\n[txm: process exited, %s]\r\n", p.exitStatus))
+	p.write(msg)
+	s.outputs++
+	if s.plainLog {
+		s.logPaneLines(p, int(p.rows), true)
+	}
+	p.notifyWatchersLocked()
+	s.paneOutputLocked(p, msg)
+}
+
+// respawn restarts the original command of dead panes in their terminals,
+// below their final output. Without a pane every dead pane of the window is
+// restarted, and without a window every dead pane of the session.
+func (s *nativeServer) respawn(window, pane string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var panes []*serverPane
+	switch {
+	case pane != "":
+		p, err := s.findPaneLocked(window, pane)
+		if err != nil {
+			return err
+		}
+		if !p.dead {
+			return fmt.Errorf("pane %d is still running", p.id)
+		}
+		panes = append(panes, p)
+	case window != "":
+		w, err := s.findWindowLocked(window)
+		if err != nil {
+			return err
+		}
+		panes = deadPanes(w.panes)
+	default:
+		for _, w := range s.windows {
+			panes = append(panes, deadPanes(w.panes)...)
+		}
+	}
+	if len(panes) == 0 {
+		return fmt.Errorf("no dead panes to respawn")
+	}
+
+	for _, p := range panes {
+		cmd := exec.Command(p.cmd.Path)
+		cmd.Args = p.cmd.Args
+		cmd.Dir = p.cmd.Dir
+		cmd.Env = s.childEnvLocked()
+		ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: p.cols, Rows: p.rows})
+		if err != nil {
+			return err
+		}
+		p.cmd, p.ptmx, p.dead, p.exitStatus = cmd, ptmx, false, ""
+		go s.readPane(p)
+	}
+	return nil
+}
+
+func deadPanes(panes []*serverPane) []*serverPane {
+	var dead []*serverPane
+	for _, p := range panes {
+		if p.dead {
+			dead = append(dead, p)
+		}
+	}
+	return dead
+}
+
+// killPaneLocked terminates a pane's process, after which readPane removes
+// the pane. Dead panes have no process left and are removed right away.
+// s.mu must be held.
+func (s *nativeServer) killPaneLocked(p *serverPane) {
+	if p.dead {
+		s.removePaneLocked(p)
+		return
+	}
+	p.killed = true
+	p.kill()
+}
+
+// removePaneLocked drops a pane, closing its window when it was the last
+// pane and shutting the server down once no windows remain. s.mu must be
+// held.
+func (s *nativeServer) removePaneLocked(p *serverPane) {
+	w := p.window
+	for i, existing := range w.panes {
+		if existing == p {
+			w.panes = append(w.panes[:i], w.panes[i+1:]...)
+			break
+		}
+	}
+	if s.plainLog {
+		s.logPaneLines(p, int(p.rows), true)
+	}
+	p.finalScreen, _ = p.screenText(int(p.rows))
+	p.close()
+	p.notifyWatchersLocked()
+
+	if len(w.panes) > 0 {
+		w.root.remove(p)
+		if w.activePane == p {
+			w.activePane = w.panes[0]
+		}
+		w.layout(s.cols, s.rows)
+		if s.activeWindowLocked() == w {
+			s.redrawLocked()
+		}
+		return
+	}
+
+	for i, existing := range s.windows {
+		if existing != w {
+			continue
+		}
+		wasActive := i == s.active
+		s.windows = append(s.windows[:i], s.windows[i+1:]...)
+		if s.active > i || s.active >= len(s.windows) {
+			s.active--
+		}
+		if s.active < 0 {
+			s.active = 0
+		}
+		if wasActive {
+			s.redrawLocked()
+		}
+		break
+	}
+
+	if len(s.windows) == 0 {
+		s.detachAllLocked()
+		_ = s.listener.Close()
+	}
+}
+
+// findWindowLocked resolves a window by index or name. An empty target
+// means the active window. s.mu must be held.
+func (s *nativeServer) findWindowLocked(target string) (*serverWindow, error) {
+	if target == "" {
+		if w := s.activeWindowLocked(); w != nil {
+			return w, nil
+		}
+		return nil, fmt.Errorf("session has no windows")
+	}
+	if id, err := strconv.Atoi(target); err == nil {
+		for _, w := range s.windows {
+			if w.id == id {
+				return w, nil
+			}
+		}
+	}
+	for _, w := range s.windows {
+		if w.name == target {
+			return w, nil
+		}
+	}
+	return nil, fmt.Errorf("window %s not found", target)
+}
+
+// findPaneLocked resolves a pane of a window by index. An empty target means
+// the window's active pane. s.mu must be held.
+func (s *nativeServer) findPaneLocked(window, target string) (*serverPane, error) {
+	w, err := s.findWindowLocked(window)
+	if err != nil {
+		return nil, err
+	}
+	if target == "" {
+		return w.activePane, nil
+	}
+	if id, err := strconv.Atoi(target); err == nil {
+		for _, p := range w.panes {
+			if p.id == id {
+				return p, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("pane %s not found in window %s", target, w.name)
+}
+
+func (s *nativeServer) listWindows() []backend.WindowInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]backend.WindowInfo, 0, len(s.windows))
+	for i, w := range s.windows {
+		infos = append(infos, backend.WindowInfo{
+			ID:     w.id,
+			Name:   w.name,
+			Active: i == s.active,
+			Panes:  len(w.panes),
+			Cols:   s.cols,
+			Rows:   s.rows,
+		})
+	}
+	return infos
+}
+
+func (s *nativeServer) killWindow(target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, err := s.findWindowLocked(target)
+	if err != nil {
+		return err
+	}
+	// Removing the last pane also removes the window.
+	for _, p := range append([]*serverPane(nil), w.panes...) {
+		s.killPaneLocked(p)
+	}
+	return nil
+}
+
+// killAll terminates every process of the session, which shuts the server
+// down once they are gone.
+func (s *nativeServer) killAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, w := range append([]*serverWindow(nil), s.windows...) {
+		for _, p := range append([]*serverPane(nil), w.panes...) {
+			s.killPaneLocked(p)
+		}
+	}
+}
+
+// selectWindow makes another window active. The target may be "next",
+// "prev" or anything findWindowLocked accepts.
+func (s *nativeServer) selectWindow(target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.windows) == 0 {
+		return fmt.Errorf("session has no windows")
+	}
+	switch target {
+	case "next":
+		s.active = (s.active + 1) % len(s.windows)
+	case "prev":
+		s.active = (s.active + len(s.windows) - 1) % len(s.windows)
+	default:
+		w, err := s.findWindowLocked(target)
+		if err != nil {
+			return err
+		}
+		for i, existing := range s.windows {
+			if existing == w {
+				s.active = i
+			}
+		}
+	}
+	s.redrawLocked()
+	return nil
+}
+
+func (s *nativeServer) renameWindow(target, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("new window name must not be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, err := s.findWindowLocked(target)
+	if err != nil {
+		return err
+	}
+	w.name = newName
+	return nil
+}
+
+// splitWindow splits the active pane of a window and starts a new shell in
+// the new pane. Direction "v" stacks the panes, "h" puts them side by side.
+func (s *nativeServer) splitWindow(target, direction string) error {
+	if direction != "v" && direction != "h" {
+		return fmt.Errorf("direction must be 'v' or 'h'")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, err := s.findWindowLocked(target)
+	if err != nil {
+		return err
+	}
+	old := w.activePane
+	vertical := direction == "v"
+	if (vertical && old.rows < 3) || (!vertical && old.cols < 3) {
+		return fmt.Errorf("pane %d is too small to split", old.id)
+	}
+
+	p, err := s.startPaneLocked(w, nil, old.cols, old.rows)
+	if err != nil {
+		return err
+	}
+	w.root.find(old).split(p, vertical)
+	w.activePane = p
+	w.layout(s.cols, s.rows)
+	if s.activeWindowLocked() == w {
+		s.redrawLocked()
+	}
+
+	go s.readPane(p)
+	return nil
+}
+
+func (s *nativeServer) listPanes(window string) ([]backend.PaneInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, err := s.findWindowLocked(window)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]backend.PaneInfo, 0, len(w.panes))
+	for _, p := range w.panes {
+		info := backend.PaneInfo{
+			ID:      p.id,
+			Active:  p == w.activePane,
+			Command: filepath.Base(p.cmd.Path),
+			Cols:    p.cols,
+			Rows:    p.rows,
+			Dead:    p.dead,
+		}
+		if p.cmd.Process != nil {
+			info.PID = p.cmd.Process.Pid
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (s *nativeServer) killPane(window, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.findPaneLocked(window, target)
+	if err != nil {
+		return err
+	}
+	s.killPaneLocked(p)
+	return nil
+}
+
+// selectPane focuses another pane of a window. The target may be "next",
+// "prev" or a pane index.
+func (s *nativeServer) selectPane(window, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, err := s.findWindowLocked(window)
+	if err != nil {
+		return err
+	}
+	switch target {
+	case "next", "prev":
+		for i, p := range w.panes {
+			if p != w.activePane {
+				continue
+			}
+			if target == "next" {
+				i++
+			} else {
+				i += len(w.panes) - 1
+			}
+			w.activePane = w.panes[i%len(w.panes)]
+			break
+		}
+	default:
+		p, err := s.findPaneLocked(window, target)
+		if err != nil {
+			return err
+		}
+		w.activePane = p
+	}
+	if s.activeWindowLocked() == w && len(w.panes) > 1 {
+		s.redrawLocked()
+	}
+	return nil
+}
+
+// layout assigns every pane its rectangle and resizes the PTYs that changed.
+func (w *serverWindow) layout(cols, rows uint16) {
+	w.root.layout(0, 0, cols, rows)
+}
+
+func (n *layoutNode) layout(x, y, cols, rows uint16) {
+	n.x, n.y, n.cols, n.rows = x, y, cols, rows
+	if n.pane != nil {
+		n.pane.x, n.pane.y = x, y
+		if n.pane.cols != cols || n.pane.rows != rows {
+			n.pane.resize(cols, rows)
+		}
+		return
+	}
+
+	// One cell between the children is reserved for the border.
+	if n.vertical {
+		first := splitSize(rows)
+		n.children[0].layout(x, y, cols, first)
+		n.children[1].layout(x, y+first+1, cols, rows-first-1)
+	} else {
+		first := splitSize(cols)
+		n.children[0].layout(x, y, first, rows)
+		n.children[1].layout(x+first+1, y, cols-first-1, rows)
+	}
+}
+
+// splitSize returns the size of the first half of a split of the given
+// size, leaving room for a one cell border.
+func splitSize(size uint16) uint16 {
+	if size < 3 {
+		return 1
+	}
+	return (size - 1) / 2
+}
+
+// find returns the leaf holding p.
+func (n *layoutNode) find(p *serverPane) *layoutNode {
+	if n.pane == p {
+		return n
+	}
+	for _, c := range n.children {
+		if c == nil {
+			continue
+		}
+		if found := c.find(p); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// split turns the leaf n into a split of its pane and p, with p placed
+// second.
+func (n *layoutNode) split(p *serverPane, vertical bool) {
+	n.children[0] = &layoutNode{parent: n, pane: n.pane}
+	n.children[1] = &layoutNode{parent: n, pane: p}
+	n.pane = nil
+	n.vertical = vertical
+}
+
+// remove deletes the leaf holding p from the tree rooted at n, letting its
+// sibling take over the space of their parent.
+func (n *layoutNode) remove(p *serverPane) {
+	leaf := n.find(p)
+	if leaf == nil || leaf.parent == nil {
+		return
+	}
+	parent := leaf.parent
+	sibling := parent.children[0]
+	if sibling == leaf {
+		sibling = parent.children[1]
+	}
+	parent.pane = sibling.pane
+	parent.vertical = sibling.vertical
+	parent.children = sibling.children
+	for _, c := range parent.children {
+		if c != nil {
+			c.parent = parent
+		}
+	}
+}
+
+// snapshot renders the pane's screen and scrollback as VT sequences.
+func (p *serverPane) snapshot() (string, error) {
+	return p.format(libghostty.FormatterFormatVT)
+}
+
+// text renders the pane's screen and scrollback as plain text.
+func (p *serverPane) text() (string, error) {
+	return p.format(libghostty.FormatterFormatPlain)
+}
+
+// screenText renders the visible screen of a pane of rows as plain text.
+func (p *serverPane) screenText(rows int) (string, error) {
+	text, err := p.text()
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(screenLines(text, rows), "\n"), nil
+}
+
+// format renders the pane's screen and scrollback in the given format.
+func (p *serverPane) format(format libghostty.FormatterFormat) (string, error) {
+	p.termMu.Lock()
+	defer p.termMu.Unlock()
+
+	if p.term == nil {
+		return "", fmt.Errorf("pane %d is closed", p.id)
+	}
+	f, err := libghostty.NewFormatter(p.term, libghostty.WithFormatterFormat(format))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return f.FormatString()
+}
+
+// write feeds output to the pane's terminal.
+func (p *serverPane) write(data []byte) {
+	p.termMu.Lock()
+	defer p.termMu.Unlock()
+	if p.term != nil {
+		_, _ = p.term.Write(data)
+	}
+}
+
+func (p *serverPane) resize(cols, rows uint16) {
+	p.cols, p.rows = cols, rows
+	_ = pty.Setsize(p.ptmx, &pty.Winsize{
+		Rows: rows,
+		Cols: cols,
+	})
+
+	p.termMu.Lock()
+	if p.term != nil {
+		_ = p.term.Resize(cols, rows, 0, 0)
+	}
+	p.termMu.Unlock()
+}
+
+func (p *serverPane) kill() {
+	if p.cmd.Process != nil {
+		_ = p.cmd.Process.Kill()
+	}
+}
+
+func (p *serverPane) close() {
+	_ = p.ptmx.Close()
+
+	p.termMu.Lock()
+	if p.term != nil {
+		p.term.Close()
+		p.term = nil
+	}
+	p.termMu.Unlock()
+}
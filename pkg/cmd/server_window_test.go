@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+func TestNewWindowRunsShell(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	// remain-on-exit keeps the pane around when it is killed below.
+	s := &nativeServer{argv: []string{"sleep", "60"}, remainOnExit: true, cols: 80, rows: 24}
+	if _, err := s.runCommand(backend.Command{Name: "new-window", Args: []string{"logs"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.activeWindowLocked()
+	p := w.activePane
+	defer p.kill()
+	if w.name != "logs" || !slices.Equal(p.cmd.Args, []string{"/bin/sh"}) {
+		t.Errorf("new window %q runs %q; want logs running the shell", w.name, p.cmd.Args)
+	}
+}
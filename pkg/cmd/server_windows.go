@@ -0,0 +1,9 @@
+//go:build windows
+
+package cmd
+
+import "os"
+
+func foregroundProcess(ptmx *os.File) string {
+	return ""
+}
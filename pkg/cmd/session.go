@@ -3,13 +3,32 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+	"github.com/MohamedElashri/txm/pkg/config"
 )
 
 var createLogFile string
+var createRemainOnExit bool
+var createLogFormat string
+var createLogTimestamps bool
+var createSizePolicy string
+var createCwd string
+var createEnv []string
+var createEnvFile string
+var createTerm string
+var createLogin bool
+var createSize string
+var gcDryRun bool
+var gcKeepLogs bool
 var attachReadOnly bool
+var attachReconnect bool
+var attachDetachOthers bool
+var attachSync bool
 
 var createCmd = &cobra.Command{
 	Use:   "create [session_name] [command...]",
@@ -27,6 +46,44 @@ var createCmd = &cobra.Command{
 		if createLogFile != "" {
 			_ = os.Setenv("TXM_LOG_FILE", createLogFile)
 		}
+		if createLogFormat != "" {
+			if _, err := config.ParseLogFormat(createLogFormat); err != nil {
+				return err
+			}
+			_ = os.Setenv("TXM_LOG_FORMAT", createLogFormat)
+		}
+		if createLogTimestamps {
+			_ = os.Setenv("TXM_LOG_TIMESTAMPS", "1")
+		}
+		if createSizePolicy != "" {
+			if err := requireNative("--size-policy"); err != nil {
+				return err
+			}
+			if _, err := config.ParseSizePolicy(createSizePolicy); err != nil {
+				return err
+			}
+			_ = os.Setenv("TXM_SIZE_POLICY", createSizePolicy)
+		}
+		if createRecordFile != "" {
+			path, err := filepath.Abs(createRecordFile)
+			if err != nil {
+				return err
+			}
+			_ = os.Setenv("TXM_RECORD_FILE", path)
+		}
+		if createRemainOnExit {
+			_ = os.Setenv("TXM_REMAIN_ON_EXIT", "1")
+		}
+		spawn, err := createSpawnOptions()
+		if err != nil {
+			return err
+		}
+		if err := spawn.Setenv(); err != nil {
+			return err
+		}
+		if spawn.Cols != 0 && (manager.Backend.Name() == "zellij" || manager.Backend.Name() == "screen") {
+			logInstance.Warning(fmt.Sprintf("--size is not supported by %s and is ignored", manager.Backend.Name()))
+		}
 
 		if err := manager.Backend.CreateSession(name, args[1:]...); err != nil {
 			logInstance.Error(fmt.Sprintf("Failed to create %s session '%s': %v", manager.Backend.Name(), name, err))
@@ -37,6 +94,49 @@ var createCmd = &cobra.Command{
 	},
 }
 
+// createSpawnOptions collects the flags of txm create that control how the
+// session's processes start. Variables given with --env override those
+// from --env-file.
+func createSpawnOptions() (backend.SpawnOptions, error) {
+	spawn := backend.SpawnOptions{Term: createTerm, Login: createLogin}
+	if createCwd != "" {
+		dir, err := filepath.Abs(createCwd)
+		if err != nil {
+			return spawn, err
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return spawn, fmt.Errorf("not a directory: %s", createCwd)
+		}
+		spawn.Dir = dir
+	}
+	if createEnvFile != "" {
+		f, err := os.Open(createEnvFile)
+		if err != nil {
+			return spawn, err
+		}
+		env, err := backend.ParseEnvFile(f)
+		_ = f.Close()
+		if err != nil {
+			return spawn, fmt.Errorf("%s: %v", createEnvFile, err)
+		}
+		spawn.Env = env
+	}
+	for _, kv := range createEnv {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			return spawn, fmt.Errorf("invalid --env %q: expected KEY=VALUE", kv)
+		}
+		spawn.Env = append(spawn.Env, kv)
+	}
+	if createSize != "" {
+		cols, rows, ok := config.FixedSize(createSize)
+		if !ok {
+			return spawn, fmt.Errorf("invalid size: %s (use COLSxROWS)", createSize)
+		}
+		spawn.Cols, spawn.Rows = cols, rows
+	}
+	return spawn, nil
+}
+
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all active sessions",
@@ -57,7 +157,21 @@ var attachCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var name string
 
-		if len(args) == 0 {
+		if cmd.Flags().Changed("via") && strings.TrimSpace(attachVia) == "" {
+			return fmt.Errorf(`--via needs a command that runs txm proxy, such as "ssh host txm proxy"`)
+		}
+		if attachVia != "" {
+			// The session lives on the other side of the proxy command,
+			// which resolves and checks the name itself.
+			if err := requireNative("--via"); err != nil {
+				return err
+			}
+			if len(args) != 1 {
+				return fmt.Errorf("--via needs exactly one session name")
+			}
+			name = args[0]
+			_ = os.Setenv("TXM_ATTACH_VIA", attachVia)
+		} else if len(args) == 0 {
 			sessions, err := manager.Backend.GetSessions()
 			if err != nil {
 				return fmt.Errorf("failed to get sessions: %v", err)
@@ -74,6 +188,18 @@ var attachCmd = &cobra.Command{
 			} else {
 				return fmt.Errorf("multiple sessions exist, please specify one to attach to")
 			}
+		} else if strings.Contains(args[0], "/") {
+			// Another user's shared session: never prefixed or created.
+			if _, _, err := parseSharedName(args[0]); err != nil {
+				return err
+			}
+			if err := requireNative("attaching to a shared session"); err != nil {
+				return err
+			}
+			if len(args) > 1 {
+				return fmt.Errorf("session '%s' already exists, cannot run a new command", args[0])
+			}
+			name = args[0]
 		} else {
 			name = getSessionName(args[0])
 			if err := validateName(name); err != nil {
@@ -93,6 +219,24 @@ var attachCmd = &cobra.Command{
 		if attachReadOnly {
 			_ = os.Setenv("TXM_READ_ONLY", "1")
 		}
+		if attachReconnect {
+			if err := requireNative("--reconnect"); err != nil {
+				return err
+			}
+			_ = os.Setenv("TXM_ATTACH_RECONNECT", "1")
+		}
+		if attachDetachOthers {
+			if err := requireNative("--detach-others"); err != nil {
+				return err
+			}
+			_ = os.Setenv("TXM_ATTACH_DETACH_OTHERS", "1")
+		}
+		if attachSync {
+			if err := requireNative("--sync"); err != nil {
+				return err
+			}
+			_ = os.Setenv("TXM_ATTACH_SYNC", "1")
+		}
 
 		if err := manager.Backend.AttachSession(name); err != nil {
 			logInstance.Error(fmt.Sprintf("Failed to attach to %s session '%s': %v", manager.Backend.Name(), name, err))
@@ -102,11 +246,23 @@ var attachCmd = &cobra.Command{
 }
 
 var detachCmd = &cobra.Command{
-	Use:   "detach",
-	Short: "Detach from current session",
-	Args:  cobra.NoArgs,
+	Use:               "detach [session_name] [client]",
+	Short:             "Detach from current session, or detach clients of a session",
+	Args:              cobra.MaximumNArgs(2),
+	ValidArgsFunction: getSingleSessionCompletion,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := manager.Backend.DetachSession(); err != nil {
+		var session, client string
+		if len(args) > 0 {
+			session = getSessionName(args[0])
+			if err := validateName(session); err != nil {
+				return err
+			}
+		}
+		if len(args) > 1 {
+			client = args[1]
+		}
+
+		if err := manager.Backend.DetachSession(session, client); err != nil {
 			logInstance.Error(fmt.Sprintf("Failed to detach from %s session: %v", manager.Backend.Name(), err))
 			return nil
 		}
@@ -164,6 +320,88 @@ var renameSessionCmd = &cobra.Command{
 	},
 }
 
+var respawnCmd = &cobra.Command{
+	Use:               "respawn [session_name]",
+	Short:             "Restart the command of a session whose process has exited",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := getSessionName(args[0])
+		if err := validateName(name); err != nil {
+			return err
+		}
+
+		if err := manager.Backend.RespawnSession(name); err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to respawn %s session '%s': %v", manager.Backend.Name(), name, err))
+			return nil
+		}
+		logInstance.Info(fmt.Sprintf("Respawned %s session '%s'", manager.Backend.Name(), name))
+		return nil
+	},
+}
+
+var sizePolicyCmd = &cobra.Command{
+	Use:   "size-policy [session_name] [policy]",
+	Short: "Show or set how a native session is sized for several clients",
+	Long: "Show or set how a native session is sized when several clients are attached: to the smallest or largest client, " +
+		"to the client that resized last (latest, the default), or to a fixed size such as 120x40. " +
+		"Clients whose terminal differs from the session see it padded or cropped.",
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := getSessionName(args[0])
+		if err := validateName(name); err != nil {
+			return err
+		}
+		if err := requireNative("size-policy"); err != nil {
+			return err
+		}
+		policy := ""
+		if len(args) > 1 {
+			var err error
+			if policy, err = config.ParseSizePolicy(args[1]); err != nil {
+				return err
+			}
+		}
+
+		current, err := backend.SessionSizePolicy(name, policy)
+		if err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to set the size policy of session '%s': %v", name, err))
+			return nil
+		}
+		if policy == "" {
+			fmt.Println(current)
+			return nil
+		}
+		logInstance.Info(fmt.Sprintf("Session '%s' now uses size policy %s", name, current))
+		return nil
+	},
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove sockets and log files left behind by dead native sessions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths, err := backend.CleanStaleSessions(gcKeepLogs, gcDryRun)
+		for _, p := range paths {
+			if gcDryRun {
+				fmt.Printf("would remove %s\n", p)
+			} else {
+				fmt.Printf("removed %s\n", p)
+			}
+		}
+		if err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to clean up native sessions: %v", err))
+			return nil
+		}
+		if len(paths) == 0 {
+			logInstance.Info("No stale native sessions found")
+		}
+		return nil
+	},
+}
+
 var nukeCmd = &cobra.Command{
 	Use:   "nuke",
 	Short: "Remove all sessions",
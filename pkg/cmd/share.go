@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+var shareUser string
+var shareReadOnly bool
+var shareReadWrite bool
+
+var shareCmd = &cobra.Command{
+	Use:               "share [session_name]",
+	Short:             "Let another local user attach to a native session, or list who can",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := getSessionName(args[0])
+		if err := validateName(name); err != nil {
+			return err
+		}
+		if err := requireNative("share"); err != nil {
+			return err
+		}
+		if shareReadOnly && shareReadWrite {
+			return fmt.Errorf("--read-only and --read-write are mutually exclusive")
+		}
+
+		if shareUser == "" {
+			shares, err := backend.SessionShares(name)
+			if err != nil {
+				logInstance.Error(fmt.Sprintf("Failed to list shares of session '%s': %v", name, err))
+				return nil
+			}
+			if len(shares) == 0 {
+				logInstance.Info(fmt.Sprintf("Session '%s' is not shared", name))
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "USER\tUID\tACCESS")
+			for _, s := range shares {
+				access := "read-write"
+				if s.ReadOnly {
+					access = "read-only"
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\n", s.User, s.UID, access)
+			}
+			return w.Flush()
+		}
+
+		if err := backend.ShareSession(name, shareUser, !shareReadWrite); err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to share session '%s' with %s: %v", name, shareUser, err))
+			return nil
+		}
+		owner := "<you>"
+		if u, err := user.Current(); err == nil {
+			owner = u.Username
+		}
+		logInstance.Info(fmt.Sprintf("Shared session '%s' with %s; they can attach with: txm attach %s/%s", name, shareUser, owner, name))
+		return nil
+	},
+}
+
+var unshareCmd = &cobra.Command{
+	Use:               "unshare [session_name]",
+	Short:             "Revoke another user's access to a native session",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: getSingleSessionCompletion,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := getSessionName(args[0])
+		if err := validateName(name); err != nil {
+			return err
+		}
+		if err := requireNative("unshare"); err != nil {
+			return err
+		}
+		if shareUser == "" {
+			return fmt.Errorf("--user is required")
+		}
+
+		if err := backend.UnshareSession(name, shareUser); err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to unshare session '%s' with %s: %v", name, shareUser, err))
+			return nil
+		}
+		logInstance.Info(fmt.Sprintf("Session '%s' is no longer shared with %s", name, shareUser))
+		return nil
+	},
+}
+
+// requireNative fails commands that only the native backend implements.
+func requireNative(command string) error {
+	if manager.Backend.Name() != "native" {
+		return fmt.Errorf("%s is only supported by the native backend", command)
+	}
+	return nil
+}
+
+// parseSharedName splits "owner/session", the name of another user's
+// shared native session.
+func parseSharedName(name string) (owner, session string, err error) {
+	owner, session, _ = strings.Cut(name, "/")
+	if owner == "" || strings.Contains(session, "/") {
+		return "", "", fmt.Errorf("invalid shared session '%s': expected owner/session", name)
+	}
+	if err := validateName(session); err != nil {
+		return "", "", err
+	}
+	return owner, session, nil
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/MohamedElashri/txm/pkg/backend"
+)
+
+var waitMatch string
+var waitIdle time.Duration
+var waitExit bool
+var waitTimeout time.Duration
+
+var waitCmd = &cobra.Command{
+	Use:   "wait [session_name] [window] [pane]",
+	Short: "Wait for output, a quiet screen or the exit of a pane",
+	Long: "Block until the visible screen of a pane matches --match, has not changed for --idle, or its process exits with --exit. " +
+		"Without a window and pane the active pane is watched. Exits non-zero when --timeout expires first.",
+	Args:              cobra.RangeArgs(1, 3),
+	ValidArgsFunction: getSingleSessionCompletion,
+	Run: func(cmd *cobra.Command, args []string) {
+		session := getSessionName(args[0])
+		if err := validateName(session); err != nil {
+			logInstance.Error(err.Error())
+			os.Exit(1)
+		}
+
+		opts := backend.WaitOptions{Idle: waitIdle, Exit: waitExit, Timeout: waitTimeout}
+		if len(args) > 1 {
+			opts.Window = args[1]
+		}
+		if len(args) > 2 {
+			opts.Pane = args[2]
+		}
+		conditions := 0
+		if waitMatch != "" {
+			// The screen has many lines, so let ^ and $ match at each.
+			re, err := regexp.Compile("(?m)" + waitMatch)
+			if err != nil {
+				logInstance.Error(fmt.Sprintf("Invalid pattern: %v", err))
+				os.Exit(1)
+			}
+			opts.Match = re
+			conditions++
+		}
+		if waitIdle > 0 {
+			conditions++
+		}
+		if waitExit {
+			conditions++
+		}
+		if conditions != 1 {
+			logInstance.Error("Specify exactly one of --match, --idle and --exit")
+			os.Exit(1)
+		}
+
+		err := manager.Backend.WaitSession(session, opts)
+		if errors.Is(err, backend.ErrWaitTimeout) {
+			logInstance.Error(fmt.Sprintf("Timed out after %v waiting for session '%s'", waitTimeout, session))
+			os.Exit(1)
+		}
+		if err != nil {
+			logInstance.Error(fmt.Sprintf("Failed to wait for session '%s': %v", session, err))
+			os.Exit(1)
+		}
+	},
+}
@@ -34,12 +34,99 @@ func ParseBackend(s string) (BackendType, error) {
 	}
 }
 
+// DefaultPrefixKey is the key that starts a command in the native attach
+// client unless the config file sets prefix_key.
+const DefaultPrefixKey = "C-\\"
+
+// ParsePrefixKey parses a control key written as "C-a" or "^a" into the byte
+// the terminal sends for it. Escape (C-[) is rejected because it starts the
+// sequences sent by arrow and function keys.
+func ParsePrefixKey(s string) (byte, error) {
+	var c byte
+	switch {
+	case len(s) == 3 && (s[:2] == "C-" || s[:2] == "c-"):
+		c = s[2]
+	case len(s) == 2 && s[0] == '^':
+		c = s[1]
+	default:
+		return 0, fmt.Errorf("invalid prefix key: %s (use C-<key>, e.g. C-a)", s)
+	}
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	if c < '@' || c > '_' {
+		return 0, fmt.Errorf("invalid prefix key: %s (use C-<key>, e.g. C-a)", s)
+	}
+	if c == '[' {
+		return 0, fmt.Errorf("invalid prefix key: %s is Escape", s)
+	}
+	return c & 0x1f, nil
+}
+
+// ParseModeKeys validates the key bindings used by the copy mode of native
+// sessions, "vi" or "emacs".
+func ParseModeKeys(s string) (string, error) {
+	switch s {
+	case "vi", "emacs":
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid mode keys: %s (use vi or emacs)", s)
+	}
+}
+
+// ParseLogFormat validates the format of native session logs: "raw" PTY
+// output or "plain" text rendered by the terminal.
+func ParseLogFormat(s string) (string, error) {
+	switch s {
+	case "raw", "plain":
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid log format: %s (use raw or plain)", s)
+	}
+}
+
+// ParseSizePolicy validates how native sessions size themselves when
+// several clients are attached: "smallest", "largest", "latest" or a fixed
+// size such as "120x40".
+func ParseSizePolicy(s string) (string, error) {
+	switch s {
+	case "smallest", "largest", "latest":
+		return s, nil
+	}
+	if _, _, ok := FixedSize(s); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid size policy: %s (use smallest, largest, latest or COLSxROWS)", s)
+}
+
+// FixedSize parses a size policy of the form COLSxROWS.
+func FixedSize(policy string) (cols, rows uint16, ok bool) {
+	c, r, found := strings.Cut(policy, "x")
+	if !found {
+		return 0, 0, false
+	}
+	cn, err1 := strconv.ParseUint(c, 10, 16)
+	rn, err2 := strconv.ParseUint(r, 10, 16)
+	if err1 != nil || err2 != nil || cn == 0 || rn == 0 {
+		return 0, 0, false
+	}
+	return uint16(cn), uint16(rn), true
+}
+
 // Config represents the configuration for txm
 type Config struct {
 	DefaultBackend BackendType
 	BackendOrder    []BackendType
 	ScrollbackSize  int
 	LogRotationSize int
+	PrefixKey       string
+	ModeKeys        string
+	LogGenerations  int
+	LogCompress     bool
+	LogFormat       string
+	LogTimestamps   bool
+	SizePolicy      string
+	ShareGroup      string
 }
 
 // NewDefaultConfig creates a new default configuration
@@ -49,6 +136,11 @@ func NewDefaultConfig() *Config {
 		BackendOrder:    []BackendType{BackendTmux, BackendScreen, BackendZellij, BackendNative},
 		ScrollbackSize:  65536,
 		LogRotationSize: 10485760, // 10MB default
+		PrefixKey:       DefaultPrefixKey,
+		ModeKeys:        "vi",
+		LogGenerations:  1,
+		LogFormat:       "raw",
+		SizePolicy:      "latest",
 	}
 }
 
@@ -130,6 +222,36 @@ func loadConfigFile(config *Config, filePath string) error {
 					if size, err := strconv.Atoi(value); err == nil {
 						config.LogRotationSize = size
 					}
+				case "prefixkey", "prefix_key", "prefix":
+					if _, err := ParsePrefixKey(value); err == nil {
+						config.PrefixKey = value
+					}
+				case "loggenerations", "log_generations":
+					if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+						config.LogGenerations = n
+					}
+				case "logcompress", "log_compress":
+					if b, err := strconv.ParseBool(value); err == nil {
+						config.LogCompress = b
+					}
+				case "logformat", "log_format":
+					if format, err := ParseLogFormat(value); err == nil {
+						config.LogFormat = format
+					}
+				case "logtimestamps", "log_timestamps":
+					if b, err := strconv.ParseBool(value); err == nil {
+						config.LogTimestamps = b
+					}
+				case "sizepolicy", "size_policy":
+					if policy, err := ParseSizePolicy(value); err == nil {
+						config.SizePolicy = policy
+					}
+				case "modekeys", "mode_keys":
+					if keys, err := ParseModeKeys(value); err == nil {
+						config.ModeKeys = keys
+					}
+				case "sharegroup", "share_group":
+					config.ShareGroup = value
 				}
 			}
 		}
@@ -151,7 +273,7 @@ func SaveConfig(config *Config) error {
 	}
 
 	configFile := filepath.Join(configDir, "config")
-	content := fmt.Sprintf("# txm configuration file\n# Set the default backend (tmux, zellij, screen)\ndefault_backend=%s\nscrollback_size=%d\nlog_rotation_size=%d\n", config.DefaultBackend, config.ScrollbackSize, config.LogRotationSize)
+	content := fmt.Sprintf("# txm configuration file\n# Set the default backend (tmux, zellij, screen)\ndefault_backend=%s\nscrollback_size=%d\nlog_rotation_size=%d\n# Key that starts a command in native sessions, e.g. C-a\nprefix_key=%s\n# Key bindings of copy mode in native sessions, vi or emacs\nmode_keys=%s\n# Session logs: rotated files to keep, gzip them, raw or plain text, line timestamps\nlog_generations=%d\nlog_compress=%t\nlog_format=%s\nlog_timestamps=%t\n# Size of native sessions with several clients: smallest, largest, latest or COLSxROWS\nsize_policy=%s\n# Group that may connect to shared native sessions, empty for your primary group\nshare_group=%s\n", config.DefaultBackend, config.ScrollbackSize, config.LogRotationSize, config.PrefixKey, config.ModeKeys, config.LogGenerations, config.LogCompress, config.LogFormat, config.LogTimestamps, config.SizePolicy, config.ShareGroup)
 
 	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %v", err)
@@ -33,3 +33,71 @@ func TestParseBackend(t *testing.T) {
 		})
 	}
 }
+
+func TestParsePrefixKey(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    byte
+		expectError bool
+	}{
+		{"C-\\", 0x1c, false},
+		{"C-a", 0x01, false},
+		{"C-A", 0x01, false},
+		{"^b", 0x02, false},
+		{"C-]", 0x1d, false},
+		{"C-@", 0x00, false},
+		{"C-[", 0, true},
+		{"C-1", 0, true},
+		{"a", 0, true},
+		{"M-a", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParsePrefixKey(tt.input)
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error for input %q, got nil", tt.input)
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error for input %q: %v", tt.input, err)
+			}
+			if result != tt.expected {
+				t.Errorf("ParsePrefixKey(%q) = 0x%02x; want 0x%02x", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseSizePolicy(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectError bool
+	}{
+		{"smallest", false},
+		{"largest", false},
+		{"latest", false},
+		{"120x40", false},
+		{"0x40", true},
+		{"120x", true},
+		{"120x70000", true},
+		{"biggest", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := ParseSizePolicy(tt.input)
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error for input %q, got nil", tt.input)
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error for input %q: %v", tt.input, err)
+			}
+		})
+	}
+
+	if cols, rows, ok := FixedSize("120x40"); !ok || cols != 120 || rows != 40 {
+		t.Errorf("FixedSize(120x40) = %d, %d, %t", cols, rows, ok)
+	}
+}